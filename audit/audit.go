@@ -0,0 +1,58 @@
+// Package audit records changes made on firewall rules.
+package audit
+
+import (
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// Audited actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionPatch  = "patch"
+	ActionDelete = "delete"
+)
+
+// Results of an audited action
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Record describe a change made, or attempted, on a firewall rule
+type Record struct {
+	Time           time.Time `json:"time"`
+	RequestID      string    `json:"request_id,omitempty"`
+	Caller         string    `json:"caller,omitempty"`
+	Action         string    `json:"action"`
+	Project        string    `json:"project"`
+	ServiceProject string    `json:"service_project"`
+	Application    string    `json:"application"`
+	CustomName     string    `json:"custom_name"`
+	// Before and After are the rule before and after the change, nil when it does not exist
+	Before *compute.Firewall `json:"before,omitempty"`
+	After  *compute.Firewall `json:"after,omitempty"`
+	Result string            `json:"result"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(record *Record) error
+}
+
+// Sinks writes records to every sink. Implements Sink
+type Sinks []Sink
+
+// Write writes record to every sink and returns the first error
+func (s Sinks) Write(record *Record) error {
+	var first error
+	for _, sink := range s {
+		if err := sink.Write(record); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
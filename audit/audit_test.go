@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+type failingSink struct{}
+
+func (failingSink) Write(record *Record) error {
+	return fmt.Errorf("sink is down")
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.log")
+
+	sink, err := NewFileSink(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error opening sink. Got %v", err)
+	}
+	records := []*Record{
+		&Record{Action: ActionCreate, CustomName: "allow-https", After: &compute.Firewall{Name: "foo-sp-web-allow-https"}, Result: ResultSuccess},
+		&Record{Action: ActionDelete, CustomName: "allow-https", Before: &compute.Firewall{Name: "foo-sp-web-allow-https"}, Result: ResultSuccess},
+	}
+	for _, record := range records {
+		if err := sink.Write(record); err != nil {
+			t.Fatalf("Unexpected error writing record. Got %v", err)
+		}
+	}
+	sink.Close()
+
+	// One JSON record per line
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != len(records) {
+		t.Fatalf("Got %d lines expected %d", len(lines), len(records))
+	}
+	for i, line := range lines {
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Line %d is not a JSON record: %v", i, err)
+		}
+		if record.Action != records[i].Action {
+			t.Errorf("Got action %s expected %s", record.Action, records[i].Action)
+		}
+	}
+	if strings.Contains(lines[0], `"before"`) {
+		t.Errorf("Created rule should not have a before state. Got %s", lines[0])
+	}
+}
+
+func TestLoggerSink(t *testing.T) {
+	var output bytes.Buffer
+	sink := NewLoggerSink(&output)
+
+	sink.Write(&Record{Action: ActionUpdate, Application: "web", CustomName: "allow-https", Caller: "alice", Result: ResultSuccess})
+
+	if !strings.Contains(output.String(), "Audit: success update rule allow-https of application web by 'alice'") {
+		t.Errorf("Got %s expected an audit message", output.String())
+	}
+}
+
+func TestSinks(t *testing.T) {
+	var output bytes.Buffer
+	sinks := Sinks{failingSink{}, NewLoggerSink(&output)}
+
+	// Every sink is written even when one fails
+	if err := sinks.Write(&Record{Action: ActionDelete}); err == nil {
+		t.Errorf("Expected error of failing sink")
+	}
+	if output.Len() == 0 {
+		t.Errorf("Expected record to be written to other sinks")
+	}
+}
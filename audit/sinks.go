@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+// FileSink appends records to a file, one JSON document per line. Implements Sink
+type FileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileSink FileSink constructor, given file is created when missing
+func NewFileSink(filename string) (*FileSink, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Write appends record to the file
+func (f *FileSink) Write(record *Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, err = f.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file
+func (f *FileSink) Close() error {
+	return f.file.Close()
+}
+
+// LoggerSink writes records as log entries, formatted like application logs. Implements Sink
+type LoggerSink struct {
+	logger *logrus.Logger
+}
+
+// NewLoggerSink LoggerSink constructor writing to given output, usually stdout
+func NewLoggerSink(output io.Writer) *LoggerSink {
+	logger := logrus.New()
+	logger.SetOutput(output)
+	helpers.ConfigureLogger(logger)
+	return &LoggerSink{logger: logger}
+}
+
+// Write logs record with its fields
+func (l *LoggerSink) Write(record *Record) error {
+	l.logger.WithField("audit", record).Infof("Audit: %s %s rule %s of application %s by '%s'", record.Result, record.Action, record.CustomName, record.Application, record.Caller)
+	return nil
+}
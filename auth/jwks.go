@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GoogleJWKSURL is the JSON Web Key Set used by Google to sign identity tokens
+const GoogleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// minRefreshInterval prevents remote key sets to be fetched on every unknown key id
+const minRefreshInterval = time.Minute
+
+// KeySet provides public keys used to verify token signatures
+type KeySet interface {
+	Key(kid string) (*rsa.PublicKey, error)
+}
+
+// jsonWebKey describe a JSON Web Key as defined by RFC 7517
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// jsonWebKeySet describe a JSON Web Key Set as defined by RFC 7517
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// StaticKeySet is a KeySet which never changes
+type StaticKeySet map[string]*rsa.PublicKey
+
+// Key returns public key matching given key id
+func (s StaticKeySet) Key(kid string) (*rsa.PublicKey, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("Unknown key id '%s'", kid)
+}
+
+// ParseKeySet decodes RSA signing keys of a JSON Web Key Set
+func ParseKeySet(data []byte) (StaticKeySet, error) {
+	var jwks jsonWebKeySet
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("Invalid JWKS: %v", err)
+	}
+
+	keys := make(StaticKeySet)
+	for _, jwk := range jwks.Keys {
+		// Only RSA signing keys are supported
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid modulus for key '%s': %v", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid exponent for key '%s': %v", jwk.Kid, err)
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS does not contain any RSA signing key")
+	}
+	return keys, nil
+}
+
+// RemoteKeySet is a KeySet fetched from an URL and refreshed when an unknown key id is requested
+type RemoteKeySet struct {
+	url         string
+	client      *http.Client
+	mutex       sync.Mutex
+	keys        StaticKeySet
+	lastRefresh time.Time
+}
+
+// NewRemoteKeySet RemoteKeySet constructor
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key returns public key matching given key id, fetching the key set again if key is unknown
+func (s *RemoteKeySet) Key(kid string) (*rsa.PublicKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	// Keys are rotated by issuers, refresh set but not too often
+	if time.Since(s.lastRefresh) < minRefreshInterval {
+		return nil, fmt.Errorf("Unknown key id '%s'", kid)
+	}
+	s.lastRefresh = time.Now()
+
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to fetch JWKS: got status %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch JWKS: %v", err)
+	}
+
+	keys, err := ParseKeySet(data)
+	if err != nil {
+		return nil, err
+	}
+	s.keys = keys
+
+	return s.keys.Key(kid)
+}
+
+// LoadKeySet returns a KeySet from an http(s) URL or a local file path
+func LoadKeySet(source string) (KeySet, error) {
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") {
+		return NewRemoteKeySet(source), nil
+	}
+
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeySet(data)
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// leeway tolerates small clock skews between the issuer and the API
+const leeway = time.Minute
+
+// Identity describe the authenticated caller
+type Identity struct {
+	Subject string   `json:"sub"`
+	Email   string   `json:"email,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+}
+
+// String returns a human readable identifier of the caller
+func (i *Identity) String() string {
+	if i.Email != "" {
+		return i.Email
+	}
+	return i.Subject
+}
+
+// header describe the JOSE header of a token
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// audience accepts both single string and array audience claim
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// claims describe the registered and identity claims read from a token
+type claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	Expiry    int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Email     string   `json:"email"`
+	Groups    []string `json:"groups"`
+}
+
+// Verifier validates OIDC identity tokens
+type Verifier struct {
+	Keys     KeySet
+	Audience string
+	Issuers  []string
+	now      func() time.Time
+}
+
+// NewVerifier Verifier constructor
+func NewVerifier(keys KeySet, audience string, issuers ...string) *Verifier {
+	return &Verifier{
+		Keys:     keys,
+		Audience: audience,
+		Issuers:  issuers,
+		now:      time.Now,
+	}
+}
+
+// Verify checks token signature, issuer, audience and validity period and returns the caller identity
+func (v *Verifier) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Malformed token")
+	}
+
+	// Decode header
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("Malformed token header: %v", err)
+	}
+	if h.Alg != "RS256" {
+		return nil, fmt.Errorf("Unsupported signing algorithm '%s'", h.Alg)
+	}
+
+	// Verify signature
+	key, err := v.Keys.Key(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed token signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("Invalid token signature")
+	}
+
+	// Verify claims
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("Malformed token claims: %v", err)
+	}
+
+	if !contains(v.Issuers, c.Issuer) {
+		return nil, fmt.Errorf("Invalid token issuer '%s'", c.Issuer)
+	}
+	if !contains(c.Audience, v.Audience) {
+		return nil, fmt.Errorf("Invalid token audience")
+	}
+
+	now := v.now()
+	if c.Expiry == 0 || now.After(time.Unix(c.Expiry, 0).Add(leeway)) {
+		return nil, fmt.Errorf("Token is expired")
+	}
+	if c.NotBefore != 0 && now.Add(leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return nil, fmt.Errorf("Token is not valid yet")
+	}
+
+	return &Identity{
+		Subject: c.Subject,
+		Email:   c.Email,
+		Groups:  c.Groups,
+	}, nil
+}
+
+// TokenFromRequest returns the bearer token of the Authorization header
+func TokenFromRequest(r *http.Request) (string, error) {
+	value := r.Header.Get("Authorization")
+	if value == "" {
+		return "", fmt.Errorf("Missing Authorization header")
+	}
+
+	parts := strings.SplitN(value, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return "", fmt.Errorf("Authorization header must use Bearer scheme")
+	}
+	return parts[1], nil
+}
+
+// decodeSegment decodes a base64url JSON token segment
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
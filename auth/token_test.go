@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	testKid      = "test-key"
+	testAudience = "https://firewall-api.example.com"
+	testIssuer   = "https://accounts.google.com"
+)
+
+type TestCase struct {
+	Title   string
+	Header  map[string]interface{}
+	Claims  map[string]interface{}
+	Key     *rsa.PrivateKey
+	IsValid bool
+}
+
+// signToken returns a RS256 signed token with given header and claims
+func signToken(t *testing.T, key *rsa.PrivateKey, h, c map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	payload := encode(h) + "." + encode(c)
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// writeKeySet writes a JWKS containing given public key in a temporary file
+func writeKeySet(t *testing.T, key *rsa.PublicKey) string {
+	jwks := jsonWebKeySet{Keys: []jsonWebKey{
+		jsonWebKey{
+			Kty: "RSA",
+			Kid: testKid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		},
+	}}
+	data, _ := json.Marshal(jwks)
+
+	f, err := ioutil.TempFile("", "jwks-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeKeySet(t, &key.PublicKey)
+	defer os.Remove(path)
+
+	keys, err := LoadKeySet(path)
+	if err != nil {
+		t.Fatalf("Unexpected error during JWKS loading. Got %v\n", err)
+	}
+	verifier := NewVerifier(keys, testAudience, testIssuer)
+
+	now := time.Now()
+	validHeader := map[string]interface{}{"alg": "RS256", "kid": testKid}
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":    testIssuer,
+			"aud":    testAudience,
+			"sub":    "1234567890",
+			"email":  "ci@example.iam.gserviceaccount.com",
+			"groups": []string{"network-admins"},
+			"exp":    now.Add(time.Hour).Unix(),
+			"iat":    now.Unix(),
+		}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		c := validClaims()
+		c[key] = value
+		return c
+	}
+
+	suite := []TestCase{
+		TestCase{Title: "Valid token", Header: validHeader, Claims: validClaims(), Key: key, IsValid: true},
+		TestCase{Title: "Valid token with audience list", Header: validHeader, Claims: with("aud", []string{"other", testAudience}), Key: key, IsValid: true},
+		TestCase{Title: "Bad signature", Header: validHeader, Claims: validClaims(), Key: otherKey, IsValid: false},
+		TestCase{Title: "Unknown key id", Header: map[string]interface{}{"alg": "RS256", "kid": "unknown"}, Claims: validClaims(), Key: key, IsValid: false},
+		TestCase{Title: "Unsupported algorithm", Header: map[string]interface{}{"alg": "none", "kid": testKid}, Claims: validClaims(), Key: key, IsValid: false},
+		TestCase{Title: "Bad audience", Header: validHeader, Claims: with("aud", "https://another.example.com"), Key: key, IsValid: false},
+		TestCase{Title: "Bad issuer", Header: validHeader, Claims: with("iss", "https://evil.example.com"), Key: key, IsValid: false},
+		TestCase{Title: "Expired token", Header: validHeader, Claims: with("exp", now.Add(-time.Hour).Unix()), Key: key, IsValid: false},
+		TestCase{Title: "Missing expiry", Header: validHeader, Claims: with("exp", 0), Key: key, IsValid: false},
+		TestCase{Title: "Token not valid yet", Header: validHeader, Claims: with("nbf", now.Add(time.Hour).Unix()), Key: key, IsValid: false},
+	}
+
+	for _, suiteCase := range suite {
+		t.Run(suiteCase.Title, func(t *testing.T) {
+			token := signToken(t, suiteCase.Key, suiteCase.Header, suiteCase.Claims)
+			identity, err := verifier.Verify(token)
+			if suiteCase.IsValid && err != nil {
+				t.Fatalf("Expected valid token. Got error %v\n", err)
+			}
+			if !suiteCase.IsValid && err == nil {
+				t.Fatalf("Expected invalid token. Got identity %v\n", identity)
+			}
+			if suiteCase.IsValid && identity.String() != "ci@example.iam.gserviceaccount.com" {
+				t.Errorf("Bad identity. Got %s expected %s", identity.String(), "ci@example.iam.gserviceaccount.com")
+			}
+		})
+	}
+
+	// Malformed tokens must be rejected
+	if _, err := verifier.Verify("not-a-token"); err == nil {
+		t.Errorf("Expected error with malformed token")
+	}
+}
+
+func TestTokenFromRequest(t *testing.T) {
+	suite := map[string]bool{
+		"":               false,
+		"Basic dXNlcjpw": false,
+		"Bearer":         false,
+		"Bearer abc.d.e": true,
+		"bearer abc.d.e": true,
+	}
+
+	for value, isValid := range suite {
+		t.Run(value, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/", nil)
+			if value != "" {
+				r.Header.Set("Authorization", value)
+			}
+			token, err := TokenFromRequest(r)
+			if isValid && (err != nil || token != "abc.d.e") {
+				t.Errorf("Expected token abc.d.e. Got %s, error %v", token, err)
+			}
+			if !isValid && err == nil {
+				t.Errorf("Expected error with header '%s'", value)
+			}
+		})
+	}
+}
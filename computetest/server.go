@@ -0,0 +1,389 @@
+// Package computetest provides a fake Compute Engine API server for tests.
+// It speaks enough of the Compute v1 REST API to manage firewall rules and poll global operations.
+package computetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// basePath is the path prefix of Compute v1 resources, as used by the Go client
+const basePath = "/compute/v1/projects/"
+
+// Server is a fake Compute API server holding firewall rules in memory
+type Server struct {
+	// URL is the base URL of the server
+	URL string
+	// PageSize is the maximum count of rules returned by a list call when caller does not ask for less
+	PageSize int
+	// PendingPolls is the count of operation polls reporting a running operation before it is done
+	PendingPolls int
+
+	server     *httptest.Server
+	mutex      sync.Mutex
+	rules      map[string][]*compute.Firewall
+	operations map[string]*operation
+	nextID     uint64
+}
+
+// operation is an operation returned to the client along with its remaining polls
+type operation struct {
+	op      *compute.Operation
+	pending int
+}
+
+// NewServer starts a fake Compute API server. It should be closed when done
+func NewServer() *Server {
+	s := &Server{
+		PageSize:   500,
+		rules:      make(map[string][]*compute.Firewall),
+		operations: make(map[string]*operation),
+	}
+
+	r := mux.NewRouter()
+	projects := r.PathPrefix(basePath + "{project}/global").Subrouter()
+	projects.Path("/firewalls").Methods("GET").HandlerFunc(s.listFirewalls)
+	projects.Path("/firewalls").Methods("POST").HandlerFunc(s.insertFirewall)
+	projects.Path("/firewalls/{firewall}").Methods("GET").HandlerFunc(s.getFirewall)
+	projects.Path("/firewalls/{firewall}").Methods("PUT", "PATCH").HandlerFunc(s.updateFirewall)
+	projects.Path("/firewalls/{firewall}").Methods("DELETE").HandlerFunc(s.deleteFirewall)
+	projects.Path("/operations/{operation}").Methods("GET").HandlerFunc(s.getOperation)
+
+	s.server = httptest.NewServer(r)
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// ClientOptions returns options pointing a Compute client to the server
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.URL + "/compute/v1/"),
+		option.WithoutAuthentication(),
+	}
+}
+
+// AddFirewall stores a rule in given project, as if it had been created out of the tested code
+func (s *Server) AddFirewall(project string, rule *compute.Firewall) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rules[project] = append(s.rules[project], s.complete(project, rule))
+}
+
+// Firewalls returns rules stored in given project
+func (s *Server) Firewalls(project string) []*compute.Firewall {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*compute.Firewall{}, s.rules[project]...)
+}
+
+func (s *Server) listFirewalls(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	size := s.PageSize
+	if value := r.URL.Query().Get("maxResults"); value != "" {
+		maxResults, err := strconv.Atoi(value)
+		if err != nil || maxResults < 0 {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid value for field 'maxResults': '%s'.", value))
+			return
+		}
+		if maxResults > 0 && maxResults < size {
+			size = maxResults
+		}
+	}
+
+	start := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		var err error
+		if start, err = strconv.Atoi(token); err != nil || start < 0 {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid value for field 'pageToken': '%s'.", token))
+			return
+		}
+	}
+
+	match, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	var rules []*compute.Firewall
+	for _, rule := range s.rules[project] {
+		if match(rule) {
+			rules = append(rules, rule)
+		}
+	}
+	list := compute.FirewallList{
+		Kind:     "compute#firewallList",
+		Id:       fmt.Sprintf("projects/%s/global/firewalls", project),
+		SelfLink: s.link(project, "firewalls", ""),
+	}
+	for i := start; i < len(rules) && i < start+size; i++ {
+		list.Items = append(list.Items, rules[i])
+	}
+	if start+size < len(rules) {
+		list.NextPageToken = strconv.Itoa(start + size)
+	}
+	s.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, &list)
+}
+
+func (s *Server) getFirewall(w http.ResponseWriter, r *http.Request) {
+	project, name := mux.Vars(r)["project"], mux.Vars(r)["firewall"]
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.find(project, name)
+	if i < 0 {
+		writeNotFound(w, project, name)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.rules[project][i])
+}
+
+func (s *Server) insertFirewall(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	var rule compute.Firewall
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+	if rule.Name == "" {
+		writeError(w, http.StatusBadRequest, "required", "Required field 'resource.name' not specified")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.find(project, rule.Name) >= 0 {
+		writeError(w, http.StatusConflict, "alreadyExists", fmt.Sprintf("The resource 'projects/%s/global/firewalls/%s' already exists", project, rule.Name))
+		return
+	}
+
+	s.rules[project] = append(s.rules[project], s.complete(project, &rule))
+	writeJSON(w, http.StatusOK, s.startOperation(project, "insert", rule.Name))
+}
+
+func (s *Server) updateFirewall(w http.ResponseWriter, r *http.Request) {
+	project, name := mux.Vars(r)["project"], mux.Vars(r)["firewall"]
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.find(project, name)
+	if i < 0 {
+		writeNotFound(w, project, name)
+		return
+	}
+	existing := s.rules[project][i]
+
+	// Patch overwrites fields present in the body, update replaces the whole rule
+	var rule compute.Firewall
+	if r.Method == http.MethodPatch {
+		data, _ := json.Marshal(existing)
+		json.Unmarshal(data, &rule)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+	if rule.Name != name {
+		writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid value for field 'resource.name': '%s'. Firewall name cannot be changed.", rule.Name))
+		return
+	}
+
+	rule.Id = existing.Id
+	rule.CreationTimestamp = existing.CreationTimestamp
+	s.rules[project][i] = s.complete(project, &rule)
+
+	kind := "update"
+	if r.Method == http.MethodPatch {
+		kind = "patch"
+	}
+	writeJSON(w, http.StatusOK, s.startOperation(project, kind, name))
+}
+
+func (s *Server) deleteFirewall(w http.ResponseWriter, r *http.Request) {
+	project, name := mux.Vars(r)["project"], mux.Vars(r)["firewall"]
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.find(project, name)
+	if i < 0 {
+		writeNotFound(w, project, name)
+		return
+	}
+	rules := s.rules[project]
+	s.rules[project] = append(rules[:i:i], rules[i+1:]...)
+	writeJSON(w, http.StatusOK, s.startOperation(project, "delete", name))
+}
+
+func (s *Server) getOperation(w http.ResponseWriter, r *http.Request) {
+	project, name := mux.Vars(r)["project"], mux.Vars(r)["operation"]
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	op, ok := s.operations[project+"/"+name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("The resource 'projects/%s/global/operations/%s' was not found", project, name))
+		return
+	}
+
+	if op.pending > 0 {
+		op.pending--
+	} else {
+		op.op.Status = "DONE"
+		op.op.Progress = 100
+		op.op.EndTime = time.Now().Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, op.op)
+}
+
+// find returns the index of the rule matching given name, -1 when not found. Lock must be held
+func (s *Server) find(project, name string) int {
+	for i, rule := range s.rules[project] {
+		if rule.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// filterExpression matches a single `(field eq regexp)` expression of a list filter
+var filterExpression = regexp.MustCompile(`\(\s*(\w+)\s+eq\s+((?:\\.|[^)\\])*?)\s*\)`)
+
+// filterFields returns values of rule fields supported in list filters
+var filterFields = map[string]func(rule *compute.Firewall) string{
+	"name":      func(rule *compute.Firewall) string { return rule.Name },
+	"direction": func(rule *compute.Firewall) string { return rule.Direction },
+	"disabled":  func(rule *compute.Firewall) string { return strconv.FormatBool(rule.Disabled) },
+}
+
+// parseFilter returns a function matching rules selected by a list filter.
+// Only expressions using the eq syntax on name, direction and disabled are supported
+func parseFilter(filter string) (func(rule *compute.Firewall) bool, error) {
+	type expression struct {
+		field func(rule *compute.Firewall) string
+		value *regexp.Regexp
+	}
+	var expressions []expression
+	for _, match := range filterExpression.FindAllStringSubmatch(filter, -1) {
+		field, ok := filterFields[match[1]]
+		if !ok {
+			return nil, fmt.Errorf("Invalid list filter expression '%s'.", match[0])
+		}
+		value, err := regexp.Compile("^(?:" + match[2] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid list filter expression '%s'.", match[0])
+		}
+		expressions = append(expressions, expression{field, value})
+	}
+	if rest := strings.TrimSpace(filterExpression.ReplaceAllString(filter, "")); rest != "" {
+		return nil, fmt.Errorf("Invalid list filter expression '%s'.", rest)
+	}
+
+	return func(rule *compute.Firewall) bool {
+		for _, e := range expressions {
+			if !e.value.MatchString(e.field(rule)) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// complete sets output only fields and defaults as Google does. Lock must be held
+func (s *Server) complete(project string, rule *compute.Firewall) *compute.Firewall {
+	if rule.Id == 0 {
+		s.nextID++
+		rule.Id = s.nextID
+	}
+	if rule.CreationTimestamp == "" {
+		rule.CreationTimestamp = time.Now().Format(time.RFC3339)
+	}
+	if rule.Direction == "" {
+		rule.Direction = "INGRESS"
+	}
+	if rule.Priority == 0 {
+		rule.Priority = 1000
+	}
+	if rule.Network == "" {
+		rule.Network = "global/networks/default"
+	}
+	if !strings.HasPrefix(rule.Network, "https://") {
+		rule.Network = "https://www.googleapis.com/compute/v1/projects/" + project + "/" + rule.Network
+	}
+	rule.Kind = "compute#firewall"
+	rule.SelfLink = s.link(project, "firewalls", rule.Name)
+	return rule
+}
+
+// startOperation registers a new global operation on given rule. Lock must be held
+func (s *Server) startOperation(project, kind, name string) *compute.Operation {
+	s.nextID++
+	op := &compute.Operation{
+		Kind:          "compute#operation",
+		Id:            s.nextID,
+		Name:          fmt.Sprintf("operation-%d", s.nextID),
+		OperationType: kind,
+		Status:        "RUNNING",
+		TargetLink:    s.link(project, "firewalls", name),
+		InsertTime:    time.Now().Format(time.RFC3339),
+	}
+	op.SelfLink = s.link(project, "operations", op.Name)
+	s.operations[project+"/"+op.Name] = &operation{op: op, pending: s.PendingPolls}
+	return op
+}
+
+// link returns the self link of a global resource
+func (s *Server) link(project, collection, name string) string {
+	link := fmt.Sprintf("%s%s%s/global/%s", s.URL, basePath, project, collection)
+	if name != "" {
+		link += "/" + name
+	}
+	return link
+}
+
+func writeNotFound(w http.ResponseWriter, project, name string) {
+	writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("The resource 'projects/%s/global/firewalls/%s' was not found", project, name))
+}
+
+// writeError writes an error as returned by Google APIs
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	writeJSON(w, code, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"errors":  []googleapi.ErrorItem{{Reason: reason, Message: message}},
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/rbac"
+)
+
+// authorize ensure caller may perform verb on requested application, otherwise write a 403 error and returns false
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, verb rbac.Verb) bool {
+	if s.Authorizer == nil {
+		return true
+	}
+
+	_, serviceProject, application, _ := helpers.GetMuxVars(r)
+	identity, _ := auth.FromContext(r.Context())
+
+	err := s.Authorizer.Authorize(identity, serviceProject, application, verb)
+	if err != nil {
+		helpers.Logger(r.Context()).Warnf("Authorization denied: %v", err)
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/rbac"
+	"github.com/gorilla/mux"
+)
+
+func TestAuthorize(t *testing.T) {
+	policy, err := rbac.ParsePolicy([]byte(`{"rules": [{"identities": ["alice@example.com"], "service_projects": ["foo-sp"], "applications": ["web"], "verbs": ["list"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	server := NewServer(manager)
+	server.Authorizer = policy
+
+	req, err := http.NewRequest("GET", "/project/host/service_project/foo-sp/application/web", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"project": "host", "service_project": "foo-sp", "application": "web"})
+	req = req.WithContext(auth.NewContext(req.Context(), &auth.Identity{Subject: "1", Email: "alice@example.com"}))
+
+	// Allowed verb
+	rr := httptest.NewRecorder()
+	if !server.authorize(rr, req, rbac.VerbList) {
+		t.Errorf("Expected caller to be allowed. Got status %d", rr.Code)
+	}
+
+	// Denied verb
+	rr = httptest.NewRecorder()
+	if server.authorize(rr, req, rbac.VerbDelete) {
+		t.Fatalf("Expected caller to be denied")
+	}
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	expected := `{"code":403,"message":"Caller 'alice@example.com' is not allowed to delete rules of application 'web' in service project 'foo-sp'","reason":"permission_denied"}`
+	if rr.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %s want %s", rr.Body.String(), expected)
+	}
+}
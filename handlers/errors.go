@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"github.com/adeo/iwc-gcp-firewall-api/rbac"
+	"google.golang.org/api/googleapi"
+)
+
+// apiError returns the API error matching an error returned by services
+func apiError(err error) *models.APIError {
+	// Handle calls interrupted by the request deadline or a shutdown
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return models.NewAPIError(http.StatusGatewayTimeout, models.ReasonDeadlineExceeded, "Request did not complete before its deadline")
+	case errors.Is(err, context.Canceled):
+		return models.NewAPIError(http.StatusServiceUnavailable, models.ReasonCanceled, "Request was canceled")
+	}
+
+	switch value := err.(type) {
+	case *models.APIError:
+		return value
+	// Handle Google Error
+	case *googleapi.Error:
+		return models.NewGoogleAPIError(value)
+	// Handle failed Google operations
+	case *models.OperationError:
+		return models.NewOperationAPIError(value)
+	// Handle rules refused by acceptance checks
+	case *policy.ViolationError:
+		apiError := models.NewAPIError(http.StatusUnprocessableEntity, models.ReasonPolicyViolation, value.Error())
+		apiError.Violations = value.Violations
+		if len(value.Violations) == 1 {
+			apiError.Field = value.Violations[0].Field
+		}
+		return apiError
+	// Handle callers not allowed on the application
+	case *rbac.DeniedError:
+		return models.NewAPIError(http.StatusForbidden, models.ReasonPermissionDenied, value.Error())
+	default:
+		return models.NewAPIError(http.StatusInternalServerError, models.ReasonInternal, err.Error())
+	}
+}
+
+// errorResponse returns the status code and JSON body matching an error, tagged with given request ID
+func errorResponse(err error, requestID string) (int, string) {
+	apiError := *apiError(err)
+	apiError.RequestID = requestID
+	return apiError.Code, apiError.JSON()
+}
+
+// writeError writes an error returned by services with the matching status code
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code, body := errorResponse(err, helpers.RequestID(r.Context()))
+	w.WriteHeader(code)
+	fmt.Fprint(w, body)
+}
+
+// decodeBody decodes the JSON request body in value. A 400 error is written and false returned when body is invalid
+func decodeBody(w http.ResponseWriter, r *http.Request, value interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(value)
+	if err == nil {
+		return true
+	}
+
+	apiError := models.NewAPIError(http.StatusBadRequest, models.ReasonInvalidArgument, fmt.Sprintf("Invalid request body: %v", err))
+	if typeError, ok := err.(*json.UnmarshalTypeError); ok {
+		apiError.Field = typeError.Field
+	}
+	writeError(w, r, apiError)
+	return false
+}
+
+// NotFoundHandler writes an error on unknown routes
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, models.NewAPIError(http.StatusNotFound, models.ReasonNotFound, fmt.Sprintf("No route matches %s", r.URL.Path)))
+}
+
+// MethodNotAllowedHandler writes an error on known routes called with another method
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, models.NewAPIError(http.StatusMethodNotAllowed, models.ReasonInvalidArgument, fmt.Sprintf("Method %s is not allowed on %s", r.Method, r.URL.Path)))
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"github.com/adeo/iwc-gcp-firewall-api/rbac"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+type TestCase struct {
+	Title        string
+	Error        error
+	ExpectedCode int
+	ExpectedBody string
+}
+
+func TestWriteError(t *testing.T) {
+	suite := []TestCase{
+		TestCase{
+			Title:        "Google error keeps Google code",
+			Error:        &googleapi.Error{Code: http.StatusNotFound, Message: "not found"},
+			ExpectedCode: http.StatusNotFound,
+			ExpectedBody: `{"code":404,"message":"not found","reason":"not_found","request_id":"1234"}`,
+		},
+		TestCase{
+			Title:        "Policy violations are unprocessable",
+			Error:        &policy.ViolationError{Violations: []policy.Violation{policy.Violation{Check: "require_target", Message: "missing target"}}},
+			ExpectedCode: http.StatusUnprocessableEntity,
+			ExpectedBody: `{"code":422,"message":"Rule violates 1 acceptance check(s)","reason":"policy_violation","request_id":"1234","violations":[{"check":"require_target","message":"missing target"}]}`,
+		},
+		TestCase{
+			Title:        "Denied caller is forbidden",
+			Error:        &rbac.DeniedError{Caller: "alice", ServiceProject: "foo-sp", Application: "web", Verb: rbac.VerbDelete},
+			ExpectedCode: http.StatusForbidden,
+			ExpectedBody: `{"code":403,"message":"Caller 'alice' is not allowed to delete rules of application 'web' in service project 'foo-sp'","reason":"permission_denied","request_id":"1234"}`,
+		},
+		TestCase{
+			Title:        "Operation error keeps operation code",
+			Error:        &models.OperationError{Code: http.StatusGatewayTimeout, Message: "timeout", Operation: "operation-1234"},
+			ExpectedCode: http.StatusGatewayTimeout,
+			ExpectedBody: `{"code":504,"message":"timeout","reason":"deadline_exceeded","request_id":"1234","operation":"operation-1234"}`,
+		},
+		TestCase{
+			Title:        "Expired request deadline is a gateway timeout",
+			Error:        &url.Error{Op: "Get", URL: "https://compute.googleapis.com", Err: context.DeadlineExceeded},
+			ExpectedCode: http.StatusGatewayTimeout,
+			ExpectedBody: `{"code":504,"message":"Request did not complete before its deadline","reason":"deadline_exceeded","request_id":"1234"}`,
+		},
+		TestCase{
+			Title:        "Canceled request is unavailable",
+			Error:        context.Canceled,
+			ExpectedCode: http.StatusServiceUnavailable,
+			ExpectedBody: `{"code":503,"message":"Request was canceled","reason":"canceled","request_id":"1234"}`,
+		},
+		TestCase{
+			Title:        "Other errors are internal errors",
+			Error:        fmt.Errorf("boom"),
+			ExpectedCode: http.StatusInternalServerError,
+			ExpectedBody: `{"code":500,"message":"boom","reason":"internal","request_id":"1234"}`,
+		},
+	}
+
+	for _, suiteCase := range suite {
+		t.Run(suiteCase.Title, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(helpers.WithRequestID(req.Context(), "1234"))
+			rr := httptest.NewRecorder()
+			writeError(rr, req, suiteCase.Error)
+			if rr.Code != suiteCase.ExpectedCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, suiteCase.ExpectedCode)
+			}
+			if rr.Body.String() != suiteCase.ExpectedBody {
+				t.Errorf("handler returned unexpected body: got %s want %s", rr.Body.String(), suiteCase.ExpectedBody)
+			}
+		})
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	suite := []TestCase{
+		TestCase{
+			Title:        "Malformed body",
+			ExpectedCode: http.StatusBadRequest,
+			ExpectedBody: `{"code":400,"message":"Invalid request body: unexpected EOF","reason":"invalid_argument"}`,
+		},
+		TestCase{
+			Title:        "Wrong field type",
+			ExpectedCode: http.StatusBadRequest,
+			ExpectedBody: `{"code":400,"message":"Invalid request body: json: cannot unmarshal string into Go struct field Firewall.priority of type int64","reason":"invalid_argument","field":"priority"}`,
+		},
+	}
+	bodies := []string{`{"priority":`, `{"priority":"high"}`}
+
+	for i, suiteCase := range suite {
+		t.Run(suiteCase.Title, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(bodies[i]))
+			rr := httptest.NewRecorder()
+			var rule compute.Firewall
+			if decodeBody(rr, req, &rule) {
+				t.Fatalf("Expected decode to fail")
+			}
+			if rr.Code != suiteCase.ExpectedCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, suiteCase.ExpectedCode)
+			}
+			if rr.Body.String() != suiteCase.ExpectedBody {
+				t.Errorf("handler returned unexpected body: got %s want %s", rr.Body.String(), suiteCase.ExpectedBody)
+			}
+		})
+	}
+}
@@ -1,140 +1,496 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/adeo/iwc-gcp-firewall-api/helpers"
 	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/rbac"
 	"github.com/adeo/iwc-gcp-firewall-api/services"
-	"github.com/sirupsen/logrus"
 	compute "google.golang.org/api/compute/v1"
-	"google.golang.org/api/googleapi"
 )
 
 // ListFirewallRuleHandler returns a set of firewall rules
-func ListFirewallRuleHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) ListFirewallRuleHandler(w http.ResponseWriter, r *http.Request) {
 	project, serviceProject, application, _ := helpers.GetMuxVars(r)
 
-	manager, err := models.NewFirewallRuleClient()
+	if !s.authorize(w, r, rbac.VerbList) {
+		return
+	}
+
+	query, err := ruleQuery(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	applicationRule, err := services.ListFirewallRule(manager, project, serviceProject, application)
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	applicationRule, err := services.QueryFirewallRules(ctx, s.Manager, project, serviceProject, application, query)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	res, err := json.Marshal(applicationRule)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	fmt.Fprint(w, string(res))
 }
 
-// GetFirewallRuleHandler return mathing firewall rule
-func GetFirewallRuleHandler(w http.ResponseWriter, r *http.Request) {
-	project, serviceProject, application, rule := helpers.GetMuxVars(r)
+// ruleQuery returns the query described by list parameters of a request
+func ruleQuery(r *http.Request) (models.RuleQuery, error) {
+	values := r.URL.Query()
+	query := models.RuleQuery{
+		Protocol:    values.Get("protocol"),
+		SourceRange: values.Get("source_range"),
+		TargetTag:   values.Get("target_tag"),
+		CustomName:  values.Get("custom_name"),
+		Sort:        values.Get("sort"),
+		PageToken:   values.Get("page_token"),
+	}
+	invalid := func(field string) error {
+		apiError := models.NewAPIError(http.StatusBadRequest, models.ReasonInvalidArgument, fmt.Sprintf("Invalid %s '%s'", field, values.Get(field)))
+		apiError.Field = field
+		return apiError
+	}
+
+	switch direction := strings.ToUpper(values.Get("direction")); direction {
+	case "", "INGRESS", "EGRESS":
+		query.Filter.Direction = direction
+	default:
+		return query, invalid("direction")
+	}
+	if value := values.Get("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, invalid("disabled")
+		}
+		query.Filter.Disabled = &disabled
+	}
+	if value := values.Get("port"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return query, invalid("port")
+		}
+		query.Port = port
+	}
+	if value := values.Get("page_size"); value != "" {
+		pageSize, err := strconv.Atoi(value)
+		if err != nil || pageSize < 0 {
+			return query, invalid("page_size")
+		}
+		query.PageSize = pageSize
+	}
+	return query, nil
+}
+
+// CreateFirewallRulesHandler create a set of rules for an application
+func (s *Server) CreateFirewallRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project, serviceProject, application, _ := helpers.GetMuxVars(r)
+	helpers.Logger(r.Context()).Debugf("Ask to create rules %s %s %s\n", project, serviceProject, application)
+
+	if !s.authorize(w, r, rbac.VerbCreate) {
+		return
+	}
+
+	// Decode given rules in order to create them
+	var body models.FirewallRules
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	manager, plan := withPlan(r, s.Manager)
+
+	rollback := r.URL.Query().Get("rollback") == "true"
+	if plan == nil && isAsync(r) {
+		s.startOperation(w, r, func(ctx context.Context) (interface{}, error) {
+			return services.CreateFirewallRules(ctx, manager, project, serviceProject, application, body, rollback), nil
+		})
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
 
-	manager, err := models.NewFirewallRuleClient()
+	result := services.CreateFirewallRules(ctx, manager, project, serviceProject, application, body, rollback)
+
+	if plan != nil {
+		writePlan(w, r, plan, result, resultStatusCode(result, http.StatusOK))
+		return
+	}
+
+	res, err := json.Marshal(result)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	applicationRule, err := services.GetFirewallRule(manager, project, serviceProject, application, rule)
+	w.WriteHeader(resultStatusCode(result, http.StatusCreated))
+	fmt.Fprint(w, string(res))
+}
 
-	// Handle Google Error
-	if value, ok := err.(*googleapi.Error); ok {
-		w.WriteHeader(value.Code)
-		fmt.Fprint(w, models.NewGoogleApplicationError(value).JSON())
+// GetFirewallRuleHandler return mathing firewall rule
+func (s *Server) GetFirewallRuleHandler(w http.ResponseWriter, r *http.Request) {
+	project, serviceProject, application, rule := helpers.GetMuxVars(r)
+
+	if !s.authorize(w, r, rbac.VerbGet) {
 		return
 	}
 
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	applicationRule, err := services.GetFirewallRule(ctx, s.Manager, project, serviceProject, application, rule)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	res, err := json.Marshal(applicationRule)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	fmt.Fprint(w, string(res))
 }
 
 // CreateFirewallRuleHandler create a given rule
-func CreateFirewallRuleHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateFirewallRuleHandler(w http.ResponseWriter, r *http.Request) {
 	project, serviceProject, application, rule := helpers.GetMuxVars(r)
-	logrus.Debugf("Ask to create rule %s %s %s %s\n", project, serviceProject, application, rule)
+	helpers.Logger(r.Context()).Debugf("Ask to create rule %s %s %s %s\n", project, serviceProject, application, rule)
+
+	if !s.authorize(w, r, rbac.VerbCreate) {
+		return
+	}
 
 	// Decode given rule in order to create it
 	var body compute.Firewall
-	err := json.NewDecoder(r.Body).Decode(&body)
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	manager, plan := withPlan(r, s.Manager)
+
+	if plan == nil && isAsync(r) {
+		s.startOperation(w, r, func(ctx context.Context) (interface{}, error) {
+			return services.CreateFirewallRule(ctx, manager, project, serviceProject, application, rule, body)
+		})
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	applicationRule, err := services.CreateFirewallRule(ctx, manager, project, serviceProject, application, rule, body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	manager, err := models.NewFirewallRuleClient()
+	if plan != nil {
+		writePlan(w, r, plan, applicationRule, http.StatusOK)
+		return
+	}
+
+	res, err := json.Marshal(applicationRule)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprint(w, string(res))
+}
+
+// UpdateFirewallRuleHandler replace a given rule
+func (s *Server) UpdateFirewallRuleHandler(w http.ResponseWriter, r *http.Request) {
+	project, serviceProject, application, rule := helpers.GetMuxVars(r)
+	helpers.Logger(r.Context()).Debugf("Ask to update rule %s %s %s %s\n", project, serviceProject, application, rule)
+
+	if !s.authorize(w, r, rbac.VerbUpdate) {
+		return
+	}
+
+	// Decode given rule in order to update it
+	var body compute.Firewall
+	if !decodeBody(w, r, &body) {
 		return
 	}
 
-	applicationRule, err := services.CreateFirewallRule(manager, project, serviceProject, application, rule, body)
-	// Handle Google Error
-	if value, ok := err.(*googleapi.Error); ok {
-		w.WriteHeader(value.Code)
-		fmt.Fprint(w, models.NewGoogleApplicationError(value).JSON())
+	manager, plan := withPlan(r, s.Manager)
+
+	if plan == nil && isAsync(r) {
+		s.startOperation(w, r, func(ctx context.Context) (interface{}, error) {
+			if r.Method == http.MethodPatch {
+				return services.PatchFirewallRule(ctx, manager, project, serviceProject, application, rule, body)
+			}
+			return services.UpdateFirewallRule(ctx, manager, project, serviceProject, application, rule, body)
+		})
 		return
 	}
 
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	var applicationRule *models.ApplicationRule
+	var err error
+	if r.Method == http.MethodPatch {
+		applicationRule, err = services.PatchFirewallRule(ctx, manager, project, serviceProject, application, rule, body)
+	} else {
+		applicationRule, err = services.UpdateFirewallRule(ctx, manager, project, serviceProject, application, rule, body)
+	}
+
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+
+	if plan != nil {
+		writePlan(w, r, plan, applicationRule, http.StatusOK)
 		return
 	}
 
 	res, err := json.Marshal(applicationRule)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
+	fmt.Fprint(w, string(res))
+}
 
-	w.WriteHeader(http.StatusCreated)
+// ApplyFirewallRulesHandler reconciles rules of an application with the given set of rules
+func (s *Server) ApplyFirewallRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project, serviceProject, application, _ := helpers.GetMuxVars(r)
+	helpers.Logger(r.Context()).Debugf("Ask to apply rules %s %s %s\n", project, serviceProject, application)
+
+	for _, verb := range []rbac.Verb{rbac.VerbCreate, rbac.VerbUpdate, rbac.VerbDelete} {
+		if !s.authorize(w, r, verb) {
+			return
+		}
+	}
+
+	// Decode desired rules
+	var body models.FirewallRules
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	// An empty desired set deletes every rule, prevent an application to be wiped by mistake
+	if len(body) == 0 && !confirmed(w, r, application, "Applying an empty set of rules") {
+		return
+	}
+
+	manager, plan := withPlan(r, s.Manager)
+
+	if plan == nil && isAsync(r) {
+		s.startOperation(w, r, func(ctx context.Context) (interface{}, error) {
+			return services.ApplyFirewallRules(ctx, manager, project, serviceProject, application, body)
+		})
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	result, err := services.ApplyFirewallRules(ctx, manager, project, serviceProject, application, body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if plan != nil {
+		writePlan(w, r, plan, result, resultStatusCode(result, http.StatusOK))
+		return
+	}
+
+	res, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(resultStatusCode(result, http.StatusOK))
+	fmt.Fprint(w, string(res))
+}
+
+// AdoptFirewallRulesHandler assigns existing rules to an application
+func (s *Server) AdoptFirewallRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project, serviceProject, application, _ := helpers.GetMuxVars(r)
+	helpers.Logger(r.Context()).Debugf("Ask to adopt rules %s %s %s\n", project, serviceProject, application)
+
+	for _, verb := range []rbac.Verb{rbac.VerbCreate, rbac.VerbDelete} {
+		if !s.authorize(w, r, verb) {
+			return
+		}
+	}
+
+	// Decode names of the rules to adopt
+	var body models.Adoptions
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	manager, plan := withPlan(r, s.Manager)
+
+	if plan == nil && isAsync(r) {
+		s.startOperation(w, r, func(ctx context.Context) (interface{}, error) {
+			return services.AdoptFirewallRules(ctx, manager, project, serviceProject, application, body), nil
+		})
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	result := services.AdoptFirewallRules(ctx, manager, project, serviceProject, application, body)
+
+	if plan != nil {
+		writePlan(w, r, plan, result, adoptionStatusCode(result))
+		return
+	}
+
+	res, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(adoptionStatusCode(result))
+	fmt.Fprint(w, string(res))
+}
+
+// confirmed returns true when the confirm query parameter is set to the application name,
+// otherwise it writes an error telling that action requires it
+func confirmed(w http.ResponseWriter, r *http.Request, application, action string) bool {
+	if r.URL.Query().Get("confirm") == application {
+		return true
+	}
+	message := fmt.Sprintf("%s requires confirm query parameter to be set to the application name '%s'", action, application)
+	apiError := models.NewAPIError(http.StatusBadRequest, models.ReasonInvalidArgument, message)
+	apiError.Field = "confirm"
+	writeError(w, r, apiError)
+	return false
+}
+
+// DeleteFirewallRulesHandler delete every rule of an application
+func (s *Server) DeleteFirewallRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project, serviceProject, application, _ := helpers.GetMuxVars(r)
+	helpers.Logger(r.Context()).Debugf("Ask to delete rules %s %s %s\n", project, serviceProject, application)
+
+	if !s.authorize(w, r, rbac.VerbDelete) {
+		return
+	}
+
+	// Prevent an application to be wiped by mistake
+	if !confirmed(w, r, application, "Deleting every rule") {
+		return
+	}
+
+	manager, plan := withPlan(r, s.Manager)
+
+	if plan == nil && isAsync(r) {
+		s.startOperation(w, r, func(ctx context.Context) (interface{}, error) {
+			return services.DeleteFirewallRules(ctx, manager, project, serviceProject, application)
+		})
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	result, err := services.DeleteFirewallRules(ctx, manager, project, serviceProject, application)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if plan != nil {
+		writePlan(w, r, plan, result, resultStatusCode(result, http.StatusOK))
+		return
+	}
+
+	res, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(resultStatusCode(result, http.StatusOK))
 	fmt.Fprint(w, string(res))
 }
 
 // DeleteFirewallRuleHandler delete the given firewall rule
-func DeleteFirewallRuleHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeleteFirewallRuleHandler(w http.ResponseWriter, r *http.Request) {
 	project, serviceProject, application, rule := helpers.GetMuxVars(r)
-	logrus.Debugf("Ask to delete rule %s %s %s %s\n", project, serviceProject, application, rule)
+	helpers.Logger(r.Context()).Debugf("Ask to delete rule %s %s %s %s\n", project, serviceProject, application, rule)
 
-	manager, err := models.NewFirewallRuleClient()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !s.authorize(w, r, rbac.VerbDelete) {
 		return
 	}
 
-	err = services.DeleteFirewallRule(manager, project, serviceProject, application, rule)
+	manager, plan := withPlan(r, s.Manager)
 
-	// Handle Google Error
-	if value, ok := err.(*googleapi.Error); ok {
-		w.WriteHeader(value.Code)
-		fmt.Fprint(w, models.NewGoogleApplicationError(value).JSON())
+	if plan == nil && isAsync(r) {
+		s.startOperation(w, r, func(ctx context.Context) (interface{}, error) {
+			return nil, services.DeleteFirewallRule(ctx, manager, project, serviceProject, application, rule)
+		})
 		return
 	}
 
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	err := services.DeleteFirewallRule(ctx, manager, project, serviceProject, application, rule)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+
+	if plan != nil {
+		writePlan(w, r, plan, nil, http.StatusOK)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// resultStatusCode returns the status code matching a result on a set of rules
+func resultStatusCode(result *models.ApplicationResult, success int) int {
+	for _, r := range result.Results {
+		if r.Status == models.RuleStatusInvalid {
+			return http.StatusUnprocessableEntity
+		}
+	}
+	if result.Failed() {
+		return http.StatusMultiStatus
+	}
+	return success
+}
+
+// adoptionStatusCode returns the status code matching the result of an adoption,
+// 409 when rules of another application stopped it before any change
+func adoptionStatusCode(result *models.ApplicationResult) int {
+	conflict := false
+	for _, r := range result.Results {
+		switch r.Status {
+		case models.RuleStatusConflict:
+			conflict = true
+		case models.RuleStatusSkipped:
+		default:
+			return resultStatusCode(result, http.StatusOK)
+		}
+	}
+	if conflict {
+		return http.StatusConflict
+	}
+	return resultStatusCode(result, http.StatusOK)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/gorilla/mux"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// newTestRouter returns a router serving rules management routes backed by a dummy client
+func newTestRouter() (*mux.Router, *managertest.FirewallRuleDummyClient) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	r := mux.NewRouter()
+	NewServer(manager).RegisterRoutes(r)
+	return r, manager
+}
+
+func serve(router http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestFirewallRuleHandlers(t *testing.T) {
+	router, manager := newTestRouter()
+	application := "/project/host/service_project/foo-sp/application/web"
+	rule := `{"allowed":[{"IPProtocol":"tcp","ports":["443"]}]}`
+
+	suite := []struct {
+		Title        string
+		Method, URL  string
+		ExpectedCode int
+	}{
+		{"create", "POST", application + "/firewall_rule/allow-https", http.StatusCreated},
+		{"create existing", "POST", application + "/firewall_rule/allow-https", http.StatusConflict},
+		{"get", "GET", application + "/firewall_rule/allow-https", http.StatusOK},
+		{"get unknown", "GET", application + "/firewall_rule/unknown", http.StatusNotFound},
+		{"list", "GET", application, http.StatusOK},
+		{"delete", "DELETE", application + "/firewall_rule/allow-https", http.StatusNoContent},
+		{"delete unknown", "DELETE", application + "/firewall_rule/allow-https", http.StatusNotFound},
+	}
+
+	for _, test := range suite {
+		t.Run(test.Title, func(t *testing.T) {
+			rr := serve(router, test.Method, test.URL, rule)
+			if rr.Code != test.ExpectedCode {
+				t.Errorf("Got status %d expected %d: %s", rr.Code, test.ExpectedCode, rr.Body.String())
+			}
+		})
+	}
+
+	if len(manager.Rules["host"]) != 0 {
+		t.Errorf("Got %d rules expected none", len(manager.Rules["host"]))
+	}
+}
+
+func TestListFirewallRuleHandler(t *testing.T) {
+	router, _ := newTestRouter()
+	application := "/project/host/service_project/foo-sp/application/web"
+	serve(router, "POST", application+"/firewall_rule/allow-https", `{"allowed":[{"IPProtocol":"tcp","ports":["443"]}]}`)
+	serve(router, "POST", "/project/host/service_project/foo-sp/application/api/firewall_rule/allow-https", `{}`)
+
+	rr := serve(router, "GET", application, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Got status %d expected %d", rr.Code, http.StatusOK)
+	}
+
+	var applicationRule models.ApplicationRule
+	if err := json.Unmarshal(rr.Body.Bytes(), &applicationRule); err != nil {
+		t.Fatal(err)
+	}
+	if len(applicationRule.Rules) != 1 || applicationRule.Rules[0].CustomName != "allow-https" {
+		t.Errorf("Got rules %+v expected only allow-https", applicationRule.Rules)
+	}
+
+	suite := []struct {
+		Title        string
+		Query        string
+		ExpectedCode int
+		ExpectedLen  int
+	}{
+		{"filtered", "?direction=ingress&disabled=false&protocol=tcp&port=443&custom_name=allow-*&sort=-priority", http.StatusOK, 1},
+		{"no match", "?port=22", http.StatusOK, 0},
+		{"paged", "?page_size=1", http.StatusOK, 1},
+		{"invalid direction", "?direction=inbound", http.StatusBadRequest, 0},
+		{"invalid disabled", "?disabled=maybe", http.StatusBadRequest, 0},
+		{"invalid port", "?port=70000", http.StatusBadRequest, 0},
+		{"invalid page size", "?page_size=-1", http.StatusBadRequest, 0},
+		{"invalid sort", "?sort=name", http.StatusBadRequest, 0},
+	}
+
+	for _, test := range suite {
+		t.Run(test.Title, func(t *testing.T) {
+			rr := serve(router, "GET", application+test.Query, "")
+			if rr.Code != test.ExpectedCode {
+				t.Fatalf("Got status %d expected %d: %s", rr.Code, test.ExpectedCode, rr.Body.String())
+			}
+			var applicationRule models.ApplicationRule
+			json.Unmarshal(rr.Body.Bytes(), &applicationRule)
+			if len(applicationRule.Rules) != test.ExpectedLen {
+				t.Errorf("Got %d rules expected %d", len(applicationRule.Rules), test.ExpectedLen)
+			}
+		})
+	}
+}
+
+func TestFirewallRuleHandlerDeadline(t *testing.T) {
+	router, _ := newTestRouter()
+
+	// Request deadline is already exceeded when the manager is called
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req := httptest.NewRequest("GET", "/project/host/service_project/foo-sp/application/web", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("Got status %d expected %d", rr.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestDeleteFirewallRulesHandlerConfirm(t *testing.T) {
+	router, _ := newTestRouter()
+	for _, confirm := range []string{"", "?confirm=true", "?confirm=another-application"} {
+		t.Run(confirm, func(t *testing.T) {
+			rr := serve(router, "DELETE", "/project/host/service_project/foo-sp/application/web"+confirm, "")
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestApplyFirewallRulesHandlerConfirm(t *testing.T) {
+	router, manager := newTestRouter()
+	application := "/project/host/service_project/foo-sp/application/web"
+	serve(router, "POST", application+"/firewall_rule/allow-https", `{"allowed":[{"IPProtocol":"tcp","ports":["443"]}]}`)
+
+	suite := []struct {
+		Title        string
+		Query, Body  string
+		ExpectedCode int
+	}{
+		{"empty set", "", `[]`, http.StatusBadRequest},
+		{"null set", "", `null`, http.StatusBadRequest},
+		{"wrong confirm", "?confirm=another-application", `[]`, http.StatusBadRequest},
+		{"dry run", "?dry_run=true", `[]`, http.StatusBadRequest},
+	}
+	for _, test := range suite {
+		t.Run(test.Title, func(t *testing.T) {
+			rr := serve(router, "PUT", application+test.Query, test.Body)
+			if rr.Code != test.ExpectedCode {
+				t.Errorf("Got status %d expected %d: %s", rr.Code, test.ExpectedCode, rr.Body.String())
+			}
+		})
+	}
+	if len(manager.Rules["host"]) != 1 {
+		t.Fatalf("Expected rules to be kept without confirmation")
+	}
+
+	if rr := serve(router, "PUT", application+"?confirm=web", `[]`); rr.Code != http.StatusOK {
+		t.Errorf("Got status %d expected %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if len(manager.Rules["host"]) != 0 {
+		t.Errorf("Expected every rule to be deleted once confirmed")
+	}
+}
+
+func TestAdoptFirewallRulesHandler(t *testing.T) {
+	router, manager := newTestRouter()
+	manager.CreateFirewallRule(context.Background(), "host", &compute.Firewall{Name: "legacy-https"})
+	application := "/project/host/service_project/foo-sp/application/web"
+	serve(router, "POST", "/project/host/service_project/bar-sp/application/api/firewall_rule/https", `{"allowed":[{"IPProtocol":"tcp","ports":["443"]}]}`)
+
+	suite := []struct {
+		Title        string
+		Method, URL  string
+		Body         string
+		ExpectedCode int
+	}{
+		{"invalid body", "POST", application + "/adopt", `{`, http.StatusBadRequest},
+		{"unknown rule", "POST", application + "/adopt", `[{"name":"unknown"}]`, http.StatusUnprocessableEntity},
+		{"rule of another application", "POST", application + "/adopt", `[{"name":"bar-sp-api-https"},{"name":"legacy-https"}]`, http.StatusConflict},
+		{"rule of another application kept", "GET", "/project/host/service_project/bar-sp/application/api/firewall_rule/https", "", http.StatusOK},
+		{"dry run", "POST", application + "/adopt?dry_run=true", `[{"name":"legacy-https","custom_name":"allow-https"}]`, http.StatusOK},
+		{"adopt", "POST", application + "/adopt", `[{"name":"legacy-https","custom_name":"allow-https"}]`, http.StatusOK},
+		{"get", "GET", application + "/firewall_rule/allow-https", "", http.StatusOK},
+	}
+
+	for _, test := range suite {
+		t.Run(test.Title, func(t *testing.T) {
+			rr := serve(router, test.Method, test.URL, test.Body)
+			if rr.Code != test.ExpectedCode {
+				t.Errorf("Got status %d expected %d: %s", rr.Code, test.ExpectedCode, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestValidateVars(t *testing.T) {
+	router, _ := newTestRouter()
+
+	for _, url := range []string{
+		"/project/Host/service_project/foo-sp/application/web",
+		"/project/host/service_project/foo_sp/application/web",
+		"/project/host/service_project/foo-sp/application/web-/firewall_rule/allow-https",
+		"/project/host/service_project/foo-sp/application/web/firewall_rule/" + strings.Repeat("a", 64),
+	} {
+		rr := serve(router, "GET", url, "")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Got status %d expected %d for %s", rr.Code, http.StatusBadRequest, url)
+		}
+		var apiError models.APIError
+		if err := json.Unmarshal(rr.Body.Bytes(), &apiError); err != nil || apiError.Field == "" {
+			t.Errorf("Got body %s expected the invalid segment", rr.Body.String())
+		}
+	}
+}
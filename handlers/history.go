@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/rbac"
+	"github.com/adeo/iwc-gcp-firewall-api/services"
+	"github.com/gorilla/mux"
+)
+
+// ListHistoryHandler returns past revisions of the rule set of an application
+func (s *Server) ListHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	project, serviceProject, application, _ := helpers.GetMuxVars(r)
+
+	if !s.authorize(w, r, rbac.VerbList) {
+		return
+	}
+
+	applicationHistory, err := services.ListRevisions(project, serviceProject, application)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res, err := json.Marshal(applicationHistory)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	fmt.Fprint(w, string(res))
+}
+
+// RollbackFirewallRulesHandler restores rules of an application as they were at a given revision
+func (s *Server) RollbackFirewallRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project, serviceProject, application, _ := helpers.GetMuxVars(r)
+	helpers.Logger(r.Context()).Debugf("Ask to roll back rules %s %s %s\n", project, serviceProject, application)
+
+	for _, verb := range []rbac.Verb{rbac.VerbCreate, rbac.VerbUpdate, rbac.VerbDelete} {
+		if !s.authorize(w, r, verb) {
+			return
+		}
+	}
+
+	revision, err := strconv.Atoi(mux.Vars(r)["revision"])
+	if err != nil {
+		apiError := models.NewAPIError(http.StatusBadRequest, models.ReasonInvalidArgument, fmt.Sprintf("Invalid revision '%s'", mux.Vars(r)["revision"]))
+		apiError.Field = "revision"
+		writeError(w, r, apiError)
+		return
+	}
+
+	manager, plan := withPlan(r, s.Manager)
+
+	if plan == nil && isAsync(r) {
+		s.startOperation(w, r, func(ctx context.Context) (interface{}, error) {
+			return services.RollbackFirewallRules(ctx, manager, project, serviceProject, application, revision)
+		})
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	result, err := services.RollbackFirewallRules(ctx, manager, project, serviceProject, application, revision)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if plan != nil {
+		writePlan(w, r, plan, result, resultStatusCode(result, http.StatusOK))
+		return
+	}
+
+	res, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(resultStatusCode(result, http.StatusOK))
+	fmt.Fprint(w, string(res))
+}
+
+// DetectDriftHandler compares live rules of an application with its desired state
+func (s *Server) DetectDriftHandler(w http.ResponseWriter, r *http.Request) {
+	project, serviceProject, application, _ := helpers.GetMuxVars(r)
+
+	if !s.authorize(w, r, rbac.VerbList) {
+		return
+	}
+
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	report, err := services.DetectDrift(ctx, s.Manager, project, serviceProject, application)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res, err := json.Marshal(report)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	fmt.Fprint(w, string(res))
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/history"
+	"github.com/adeo/iwc-gcp-firewall-api/services"
+)
+
+func TestHistoryHandlers(t *testing.T) {
+	router, _ := newTestRouter()
+	application := "/project/host/service_project/foo-sp/application/web"
+
+	// History is disabled by default
+	if rr := serve(router, "GET", application+"/history", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Got status %d expected %d", rr.Code, http.StatusNotFound)
+	}
+
+	services.History = history.NewMemoryStore()
+	defer func() { services.History = nil }()
+	serve(router, "POST", application+"/firewall_rule/allow-https", `{"allowed":[{"IPProtocol":"tcp","ports":["443"]}]}`)
+	serve(router, "POST", application+"/firewall_rule/allow-ssh", `{"allowed":[{"IPProtocol":"tcp","ports":["22"]}]}`)
+
+	suite := []struct {
+		Title        string
+		Method, URL  string
+		ExpectedCode int
+	}{
+		{"list", "GET", application + "/history", http.StatusOK},
+		{"drift", "GET", application + "/drift", http.StatusOK},
+		{"invalid revision", "POST", application + "/history/first/rollback", http.StatusBadRequest},
+		{"unknown revision", "POST", application + "/history/42/rollback", http.StatusNotFound},
+		{"dry run", "POST", application + "/history/1/rollback?dry_run=true", http.StatusOK},
+		{"rollback", "POST", application + "/history/1/rollback", http.StatusOK},
+	}
+
+	for _, test := range suite {
+		t.Run(test.Title, func(t *testing.T) {
+			rr := serve(router, test.Method, test.URL, "")
+			if rr.Code != test.ExpectedCode {
+				t.Errorf("Got status %d expected %d: %s", rr.Code, test.ExpectedCode, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// isAsync returns true when caller asks for the call to run in background
+func isAsync(r *http.Request) bool {
+	return r.URL.Query().Get("async") == "true"
+}
+
+// caller returns the identity of the authenticated caller, empty when authentication is disabled
+func caller(r *http.Request) string {
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		return identity.String()
+	}
+	return ""
+}
+
+// startOperation runs fn in background and writes the running operation.
+// Unlike the request context, the context given to fn is not canceled when the response is written.
+func (s *Server) startOperation(w http.ResponseWriter, r *http.Request, fn func(ctx context.Context) (interface{}, error)) {
+	// Keep caller identity, request ID, logger and trace, but not the request cancellation
+	requestID := helpers.RequestID(r.Context())
+	ctx := helpers.WithRequestID(s.Context, requestID)
+	ctx = helpers.WithLogger(ctx, helpers.Logger(r.Context()))
+	ctx = trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(r.Context()))
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		ctx = auth.NewContext(ctx, identity)
+	}
+	run := func() (interface{}, error) {
+		return fn(ctx)
+	}
+	op := s.Operations.Start(caller(r), run, func(err error) json.RawMessage {
+		_, body := errorResponse(err, requestID)
+		return json.RawMessage(body)
+	})
+
+	res, err := json.Marshal(op)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/operations/%s", op.ID))
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprint(w, string(res))
+}
+
+// GetOperationHandler returns the status of an operation run in background
+func (s *Server) GetOperationHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	// Callers only see their own operations
+	op, ok := s.Operations.Get(id)
+	if !ok || op.Caller != caller(r) {
+		writeError(w, r, models.NewAPIError(http.StatusNotFound, models.ReasonNotFound, fmt.Sprintf("Operation '%s' not found", id)))
+		return
+	}
+
+	res, err := json.Marshal(op)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	fmt.Fprint(w, string(res))
+}
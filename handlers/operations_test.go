@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/operations"
+	"github.com/gorilla/mux"
+)
+
+func TestOperations(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	server := NewServer(manager)
+	alice := &auth.Identity{Subject: "1", Email: "alice@example.com"}
+	bob := &auth.Identity{Subject: "2", Email: "bob@example.com"}
+
+	// Start an operation as alice
+	req, _ := http.NewRequest("DELETE", "/project/host/service_project/foo-sp/application/web?async=true", nil)
+	req = req.WithContext(auth.NewContext(req.Context(), alice))
+	rr := httptest.NewRecorder()
+	server.startOperation(rr, req, func(ctx context.Context) (interface{}, error) { return "deleted", nil })
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	var op operations.Operation
+	if err := json.Unmarshal(rr.Body.Bytes(), &op); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("Location") != "/operations/"+op.ID {
+		t.Errorf("Bad location header. Got %s", rr.Header().Get("Location"))
+	}
+
+	get := func(identity *auth.Identity) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/operations/"+op.ID, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": op.ID})
+		req = req.WithContext(auth.NewContext(req.Context(), identity))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.GetOperationHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Alice follows her operation until done
+	for i := 0; i < 100 && op.Status != operations.StatusDone; i++ {
+		time.Sleep(10 * time.Millisecond)
+		rr = get(alice)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		json.Unmarshal(rr.Body.Bytes(), &op)
+	}
+	if op.Result != "deleted" {
+		t.Errorf("Bad operation result. Got %v", op.Result)
+	}
+
+	// Bob can't see alice's operation
+	if rr = get(bob); rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/services"
+)
+
+// withPlan wraps manager in a PlanManager when dry run is requested
+func withPlan(r *http.Request, manager models.FirewallRuleManager) (models.FirewallRuleManager, *services.PlanManager) {
+	if r.URL.Query().Get("dry_run") != "true" {
+		return manager, nil
+	}
+	plan := services.NewPlanManager(manager)
+	return plan, plan
+}
+
+// writePlan writes planned changes and the result which would be returned without dry run
+func writePlan(w http.ResponseWriter, r *http.Request, plan *services.PlanManager, result interface{}, status int) {
+	project, serviceProject, application, _ := helpers.GetMuxVars(r)
+
+	res, err := json.Marshal(models.Plan{
+		Project:        project,
+		ServiceProject: serviceProject,
+		Application:    application,
+		DryRun:         true,
+		Actions:        plan.Actions(),
+		Result:         result,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(status)
+	fmt.Fprint(w, string(res))
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+)
+
+func TestWithPlan(t *testing.T) {
+	client := &models.FirewallRuleClient{}
+
+	req, _ := http.NewRequest("POST", "/project/host/service_project/foo-sp/application/web", nil)
+	manager, plan := withPlan(req, client)
+	if plan != nil || manager != client {
+		t.Errorf("Expected manager to be kept without dry run")
+	}
+
+	req, _ = http.NewRequest("POST", "/project/host/service_project/foo-sp/application/web?dry_run=true", nil)
+	manager, plan = withPlan(req, client)
+	if plan == nil || manager != plan {
+		t.Errorf("Expected manager to be wrapped in a plan on dry run")
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/operations"
+	"github.com/adeo/iwc-gcp-firewall-api/rbac"
+	"github.com/gorilla/mux"
+)
+
+// Server holds dependencies shared by handlers
+type Server struct {
+	// Manager is used by every request to manage rules
+	Manager models.FirewallRuleManager
+	// Authorizer controls which caller may manage which application. Every caller is allowed when nil
+	Authorizer rbac.Authorizer
+	// Operations tracks calls run in background
+	Operations *operations.Tracker
+	// RequestTimeout bounds calls to the manager made by a request. No deadline when zero
+	RequestTimeout time.Duration
+	// Context is the parent context of calls run in background
+	Context context.Context
+}
+
+// DefaultRequestTimeout is the default deadline of calls to the manager made by a request
+const DefaultRequestTimeout = 5 * time.Minute
+
+// NewServer Server constructor
+func NewServer(manager models.FirewallRuleManager) *Server {
+	return &Server{
+		Manager:        manager,
+		Operations:     operations.NewTracker(),
+		RequestTimeout: DefaultRequestTimeout,
+		Context:        context.Background(),
+	}
+}
+
+// requestContext returns the context of calls to the manager made by given request
+func (s *Server) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.RequestTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), s.RequestTimeout)
+}
+
+// RegisterRoutes registers rules management routes on given router, behind given middlewares
+func (s *Server) RegisterRoutes(r *mux.Router, middlewares ...mux.MiddlewareFunc) {
+	// Manage sets of rules
+	managerRouter := r.PathPrefix("/project/{project}/service_project/{service_project}/application/{application}").Subrouter()
+	managerRouter.Path("").Methods("GET").HandlerFunc(s.ListFirewallRuleHandler)
+	managerRouter.Path("").Methods("POST").HandlerFunc(s.CreateFirewallRulesHandler)
+	managerRouter.Path("").Methods("PUT").HandlerFunc(s.ApplyFirewallRulesHandler)
+	managerRouter.Path("").Methods("DELETE").HandlerFunc(s.DeleteFirewallRulesHandler)
+	managerRouter.Path("/adopt").Methods("POST").HandlerFunc(s.AdoptFirewallRulesHandler)
+	managerRouter.Path("/history").Methods("GET").HandlerFunc(s.ListHistoryHandler)
+	managerRouter.Path("/history/{revision}/rollback").Methods("POST").HandlerFunc(s.RollbackFirewallRulesHandler)
+	managerRouter.Path("/drift").Methods("GET").HandlerFunc(s.DetectDriftHandler)
+
+	// Manage a specific rule
+	ruleRouter := r.PathPrefix("/project/{project}/service_project/{service_project}/application/{application}/firewall_rule/{rule}").Subrouter()
+	ruleRouter.Path("").Methods("POST").HandlerFunc(s.CreateFirewallRuleHandler)
+	ruleRouter.Path("").Methods("GET").HandlerFunc(s.GetFirewallRuleHandler)
+	ruleRouter.Path("").Methods("PUT", "PATCH").HandlerFunc(s.UpdateFirewallRuleHandler)
+	ruleRouter.Path("").Methods("DELETE").HandlerFunc(s.DeleteFirewallRuleHandler)
+
+	// Follow operations run in background
+	operationRouter := r.PathPrefix("/operations/{id}").Subrouter()
+	operationRouter.Path("").Methods("GET").HandlerFunc(s.GetOperationHandler)
+
+	for _, router := range []*mux.Router{managerRouter, ruleRouter, operationRouter} {
+		router.Use(middlewares...)
+	}
+	for _, router := range []*mux.Router{managerRouter, ruleRouter} {
+		router.Use(validateVars)
+	}
+}
+
+// validateVars refuses requests whose path variables are not valid Google names before calling Google
+func validateVars(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if field, err := helpers.ValidateMuxVars(r); err != nil {
+			apiError := models.NewAPIError(http.StatusBadRequest, models.ReasonInvalidArgument, err.Error())
+			apiError.Field = field
+			writeError(w, r, apiError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
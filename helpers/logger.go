@@ -1,19 +1,110 @@
 package helpers
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"os"
+	"strings"
+	"sync"
 
 	stackdriver "github.com/TV4/logrus-stackdriver-formatter"
 	"github.com/sirupsen/logrus"
 )
 
+// specialFieldPrefix prefixes the fields Cloud Logging reads at the top level of an entry, such as its trace
+const specialFieldPrefix = "logging.googleapis.com/"
+
+type loggerKey struct{}
+
+// requestLogger holds the logger of a request, which gets fields as the request goes through middlewares
+type requestLogger struct {
+	mutex sync.Mutex
+	entry *logrus.Entry
+}
+
+// WithLogger returns a copy of ctx carrying given logger
+func WithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, &requestLogger{entry: entry})
+}
+
+// Logger returns the logger carried by ctx, the standard logger when none
+func Logger(ctx context.Context) *logrus.Entry {
+	logger, ok := ctx.Value(loggerKey{}).(*requestLogger)
+	if !ok {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	return logger.entry
+}
+
+// AddLogFields adds fields to the logger carried by ctx. Fields are seen by every later log of the request,
+// including logs of middlewares which got ctx before fields were added. Nothing is done when ctx carries no logger
+func AddLogFields(ctx context.Context, fields logrus.Fields) {
+	logger, ok := ctx.Value(loggerKey{}).(*requestLogger)
+	if !ok {
+		return
+	}
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	logger.entry = logger.entry.WithFields(fields)
+}
+
 // InitLogger initializes logrus to be compatible with google stackdriver
 func InitLogger() {
-	// Set logger as Stackdriver compliant when runtime is GCP
-	// https://cloud.google.com/run/docs/reference/container-contract#env-vars
-	if os.Getenv("K_SERVICE") != "" {
-		logrus.SetFormatter(stackdriver.NewFormatter())
+	if ConfigureLogger(logrus.StandardLogger()) {
 		log.SetOutput(logrus.StandardLogger().Writer())
 	}
 }
+
+// ConfigureLogger sets given logger as Stackdriver compliant when runtime is GCP and returns true in that case
+func ConfigureLogger(logger *logrus.Logger) bool {
+	// https://cloud.google.com/run/docs/reference/container-contract#env-vars
+	if os.Getenv("K_SERVICE") == "" {
+		return false
+	}
+	logger.SetFormatter(&specialFieldsFormatter{Formatter: stackdriver.NewFormatter()})
+	return true
+}
+
+// specialFieldsFormatter moves Cloud Logging special fields from the entry data, where the Stackdriver formatter
+// puts every field, to the top level of the entry
+type specialFieldsFormatter struct {
+	logrus.Formatter
+}
+
+// Format formats entry with the wrapped formatter then adds special fields
+func (f *specialFieldsFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	special := make(map[string]interface{})
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		if strings.HasPrefix(key, specialFieldPrefix) {
+			special[key] = value
+		} else {
+			data[key] = value
+		}
+	}
+	if len(special) == 0 {
+		return f.Formatter.Format(entry)
+	}
+
+	stripped := *entry
+	stripped.Data = data
+	b, err := f.Formatter.Format(&stripped)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range special {
+		fields[key] = value
+	}
+	b, err = json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestConfigureLogger(t *testing.T) {
+	logger := logrus.New()
+	if ConfigureLogger(logger) {
+		t.Fatalf("Expected logger to be left unchanged out of Cloud Run")
+	}
+
+	t.Setenv("K_SERVICE", "gcp-firewall-api")
+	var buffer bytes.Buffer
+	logger.SetOutput(&buffer)
+	if !ConfigureLogger(logger) {
+		t.Fatalf("Expected logger to be configured on Cloud Run")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"logging.googleapis.com/trace": "projects/host/traces/105445aa7843bc8bf206b12000100000",
+		"method":                       "GET",
+	}).Info("GET /_health")
+
+	var entry struct {
+		Trace   string `json:"logging.googleapis.com/trace"`
+		Message string `json:"message"`
+		Context struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"context"`
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("Unexpected error decoding entry %s. Got %v", buffer.String(), err)
+	}
+	if entry.Trace != "projects/host/traces/105445aa7843bc8bf206b12000100000" || entry.Message != "GET /_health" {
+		t.Errorf("Got entry %s expected trace at the top level", buffer.String())
+	}
+	if _, ok := entry.Context.Data["logging.googleapis.com/trace"]; ok || entry.Context.Data["method"] != "GET" {
+		t.Errorf("Got data %v expected only other fields", entry.Context.Data)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	if entry := Logger(context.Background()); entry.Logger != logrus.StandardLogger() {
+		t.Errorf("Expected the standard logger without request logger")
+	}
+	AddLogFields(context.Background(), logrus.Fields{"caller": "ignored"})
+
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	var buffer bytes.Buffer
+	logger.SetOutput(&buffer)
+	ctx := WithLogger(context.Background(), logger.WithField("request_id", "42"))
+
+	// Fields added by inner middlewares are seen through the context of outer ones
+	inner := context.WithValue(ctx, struct{}{}, "inner")
+	AddLogFields(inner, logrus.Fields{"caller": "alice@example.com"})
+	Logger(ctx).Info("GET /_health 200")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("Unexpected error decoding entry %s. Got %v", buffer.String(), err)
+	}
+	if entry["request_id"] != "42" || entry["caller"] != "alice@example.com" {
+		t.Errorf("Got entry %v expected request ID and caller", entry)
+	}
+}
@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+// RequestIDHeader is the header carrying the ID of a request
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID matches request IDs given by callers which are kept
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// IsValidRequestID returns true when given request ID may be reused as is
+func IsValidRequestID(id string) bool {
+	return validRequestID.MatchString(id)
+}
+
+// WithRequestID returns a copy of ctx carrying given request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, empty when none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -1,11 +1,22 @@
 package helpers
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
 
 	"github.com/gorilla/mux"
 )
 
+// MaxNameLength is the maximum length of a Google resource name
+const MaxNameLength = 63
+
+// namePattern matches valid Google resource names
+var namePattern = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+
+// projectPattern matches valid project IDs, optionally scoped by a domain
+var projectPattern = regexp.MustCompile(`^([a-z][-a-z0-9.]*[a-z0-9]:)?[a-z]([-a-z0-9]*[a-z0-9])?$`)
+
 // GetMuxVars return query vars from given request
 func GetMuxVars(r *http.Request) (project, serviceProject, application, rule string) {
 	vars := mux.Vars(r)
@@ -15,3 +26,30 @@ func GetMuxVars(r *http.Request) (project, serviceProject, application, rule str
 	rule = vars["rule"]
 	return
 }
+
+// ValidateName returns an error naming segment when value is not a valid Google resource name
+func ValidateName(segment, value string) error {
+	if len(value) > MaxNameLength {
+		return fmt.Errorf("Invalid %s '%s': must be at most %d characters", segment, value, MaxNameLength)
+	}
+	if !namePattern.MatchString(value) {
+		return fmt.Errorf("Invalid %s '%s': must start with a lowercase letter, followed by lowercase letters, digits or hyphens, and must not end with a hyphen", segment, value)
+	}
+	return nil
+}
+
+// ValidateMuxVars checks path variables of given request. It returns the name of the first invalid variable with the error
+func ValidateMuxVars(r *http.Request) (string, error) {
+	vars := mux.Vars(r)
+	if project, ok := vars["project"]; ok && (len(project) > 2*MaxNameLength || !projectPattern.MatchString(project)) {
+		return "project", fmt.Errorf("Invalid project '%s': must be a project ID", project)
+	}
+	for _, segment := range []string{"service_project", "application", "rule"} {
+		if value, ok := vars[segment]; ok {
+			if err := ValidateName(segment, value); err != nil {
+				return segment, err
+			}
+		}
+	}
+	return "", nil
+}
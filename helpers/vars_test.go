@@ -3,6 +3,7 @@ package helpers
 import (
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -73,3 +74,42 @@ func TestGetMuxVars(t *testing.T) {
 	}
 
 }
+
+func TestValidateMuxVars(t *testing.T) {
+	valid := map[string]string{"project": "example.com:host-project", "service_project": "foo-sp", "application": "web", "rule": "allow-https"}
+
+	cases := []struct {
+		Title         string
+		Parameter     string
+		Value         string
+		ExpectedField string
+	}{
+		{"valid", "", "", ""},
+		{"project", "project", "Host_Project", "project"},
+		{"uppercase", "service_project", "Foo-SP", "service_project"},
+		{"underscore", "application", "my_app", "application"},
+		{"leading digit", "application", "1app", "application"},
+		{"trailing hyphen", "rule", "allow-", "rule"},
+		{"too long", "rule", strings.Repeat("a", MaxNameLength+1), "rule"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Title, func(t *testing.T) {
+			vars := map[string]string{}
+			for key, value := range valid {
+				vars[key] = value
+			}
+			if c.Parameter != "" {
+				vars[c.Parameter] = c.Value
+			}
+
+			field, err := ValidateMuxVars(mux.SetURLVars(&http.Request{}, vars))
+			if field != c.ExpectedField || (err != nil) != (c.ExpectedField != "") {
+				t.Errorf("Got field %q error %v expected field %q", field, err, c.ExpectedField)
+			}
+			if err != nil && !strings.Contains(err.Error(), c.ExpectedField) {
+				t.Errorf("Expected error %v to name %s", err, c.ExpectedField)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FileStore keeps revisions in memory and appends them to a file, one JSON document per line.
+// Revisions already in the file are loaded when the store is opened. Implements Store
+type FileStore struct {
+	MemoryStore
+	file *os.File
+}
+
+// entry is a line of the file
+type entry struct {
+	Key      Key      `json:"key"`
+	Revision Revision `json:"revision"`
+}
+
+// NewFileStore FileStore constructor, given file is created when missing
+func NewFileStore(filename string) (*FileStore, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &FileStore{file: file}
+	store.revisions = make(map[Key][]Revision)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+		store.MemoryStore.append(e.Key, e.Revision)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Append numbers revision after the last revision of the application, writes it to the file and stores it
+func (f *FileStore) Append(key Key, revision Revision) (Revision, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	revision.Revision = len(f.revisions[key]) + 1
+	line, err := json.Marshal(entry{Key: key, Revision: revision})
+	if err != nil {
+		return Revision{}, err
+	}
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return Revision{}, err
+	}
+	return f.MemoryStore.append(key, revision), nil
+}
+
+// Close closes the file
+func (f *FileStore) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,105 @@
+// Package history keeps past revisions of the rule set of applications.
+package history
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+)
+
+// ErrNotFound is returned when a revision does not exist
+var ErrNotFound = errors.New("revision not found")
+
+// Key identifies an application
+type Key struct {
+	Project        string `json:"project"`
+	ServiceProject string `json:"service_project"`
+	Application    string `json:"application"`
+}
+
+// Revision describe the rule set of an application after a change
+type Revision struct {
+	Revision  int                  `json:"revision"`
+	Time      time.Time            `json:"time"`
+	RequestID string               `json:"request_id,omitempty"`
+	Caller    string               `json:"caller,omitempty"`
+	Rules     models.FirewallRules `json:"rules"`
+}
+
+// ApplicationHistory describe the end-user response listing revisions of an application
+type ApplicationHistory struct {
+	Project        string     `json:"project"`
+	ServiceProject string     `json:"service_project"`
+	Application    string     `json:"application"`
+	Revisions      []Revision `json:"revisions"`
+}
+
+// Store keeps revisions of applications
+type Store interface {
+	// Append stores revision as the next revision of the application and returns it numbered
+	Append(key Key, revision Revision) (Revision, error)
+	// List returns revisions of the application, oldest first
+	List(key Key) ([]Revision, error)
+	// Get returns the matching revision of the application, ErrNotFound when it does not exist
+	Get(key Key, revision int) (Revision, error)
+	// Keys returns applications having at least one revision
+	Keys() ([]Key, error)
+}
+
+// MemoryStore keeps revisions in memory. Implements Store
+type MemoryStore struct {
+	mutex     sync.Mutex
+	revisions map[Key][]Revision
+}
+
+// NewMemoryStore MemoryStore constructor
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{revisions: make(map[Key][]Revision)}
+}
+
+// Append numbers revision after the last revision of the application and stores it
+func (m *MemoryStore) Append(key Key, revision Revision) (Revision, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.append(key, revision), nil
+}
+
+// append stores revision, lock must be held
+func (m *MemoryStore) append(key Key, revision Revision) Revision {
+	revision.Revision = len(m.revisions[key]) + 1
+	m.revisions[key] = append(m.revisions[key], revision)
+	return revision
+}
+
+// List returns revisions of the application, oldest first
+func (m *MemoryStore) List(key Key) ([]Revision, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]Revision{}, m.revisions[key]...), nil
+}
+
+// Get returns the matching revision of the application
+func (m *MemoryStore) Get(key Key, revision int) (Revision, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	revisions := m.revisions[key]
+	if revision < 1 || revision > len(revisions) {
+		return Revision{}, ErrNotFound
+	}
+	return revisions[revision-1], nil
+}
+
+// Keys returns applications having at least one revision
+func (m *MemoryStore) Keys() ([]Key, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var keys []Key
+	for key := range m.revisions {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,80 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+)
+
+func testStore(t *testing.T, store Store) {
+	web := Key{Project: "host", ServiceProject: "foo-sp", Application: "web"}
+	api := Key{Project: "host", ServiceProject: "foo-sp", Application: "api"}
+
+	for i, key := range []Key{web, web, api} {
+		revision, err := store.Append(key, Revision{Rules: models.FirewallRules{{CustomName: "rule"}}, Caller: string(rune('a' + i))})
+		if err != nil {
+			t.Fatalf("Unexpected error during append. Got %v", err)
+		}
+		expected := map[int]int{0: 1, 1: 2, 2: 1}[i]
+		if revision.Revision != expected {
+			t.Errorf("Got revision %d expected %d", revision.Revision, expected)
+		}
+	}
+
+	revisions, _ := store.List(web)
+	if len(revisions) != 2 || revisions[0].Caller != "a" || revisions[1].Caller != "b" {
+		t.Errorf("Got revisions %+v expected revisions of web in order", revisions)
+	}
+
+	revision, err := store.Get(web, 2)
+	if err != nil || revision.Caller != "b" {
+		t.Errorf("Got revision %+v and error %v expected second revision of web", revision, err)
+	}
+	if keys, _ := store.Keys(); len(keys) != 2 {
+		t.Errorf("Got keys %v expected web and api", keys)
+	}
+	for _, number := range []int{0, 3} {
+		if _, err := store.Get(web, number); err != ErrNotFound {
+			t.Errorf("Got error %v expected ErrNotFound for revision %d", err, number)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "history.log")
+
+	store, err := NewFileStore(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error opening store. Got %v", err)
+	}
+	testStore(t, store)
+	store.Close()
+
+	// Revisions are loaded back and numbering goes on
+	store, err = NewFileStore(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening store. Got %v", err)
+	}
+	defer store.Close()
+
+	revisions, _ := store.List(Key{Project: "host", ServiceProject: "foo-sp", Application: "web"})
+	if len(revisions) != 2 || revisions[1].Rules[0].CustomName != "rule" {
+		t.Errorf("Got revisions %+v expected revisions to be loaded", revisions)
+	}
+	revision, _ := store.Append(Key{Project: "host", ServiceProject: "foo-sp", Application: "api"}, Revision{})
+	if revision.Revision != 2 {
+		t.Errorf("Got revision %d expected %d", revision.Revision, 2)
+	}
+}
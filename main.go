@@ -1,25 +1,80 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/adeo/iwc-gcp-firewall-api/audit"
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
 	"github.com/adeo/iwc-gcp-firewall-api/handlers"
 	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/history"
+	"github.com/adeo/iwc-gcp-firewall-api/metrics"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"github.com/adeo/iwc-gcp-firewall-api/rbac"
+	"github.com/adeo/iwc-gcp-firewall-api/services"
+	"github.com/adeo/iwc-gcp-firewall-api/tracing"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
-// log access log
+// tag every request with an ID, given by the caller or generated, and a logger carrying it
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(helpers.RequestIDHeader)
+		if !helpers.IsValidRequestID(id) {
+			id = helpers.NewRequestID()
+		}
+		w.Header().Set(helpers.RequestIDHeader, id)
+		ctx := helpers.WithRequestID(r.Context(), id)
+		ctx = helpers.WithLogger(ctx, logrus.WithField("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// responseRecorder keeps the status code and the count of bytes written by a handler
+type responseRecorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// log access log once the request is handled, with fields added to the request logger by other middlewares
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logrus.WithFields(logrus.Fields{
-			"method":      r.Method,
-			"request_uri": r.RequestURI,
-			"user_agent":  r.UserAgent(),
-		}).Printf("%s %s", r.Method, r.RequestURI)
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		helpers.Logger(r.Context()).WithFields(logrus.Fields{
+			"method":          r.Method,
+			"request_uri":     r.RequestURI,
+			"user_agent":      r.UserAgent(),
+			"remote_addr":     r.RemoteAddr,
+			"status":          recorder.code,
+			"latency_seconds": time.Since(start).Seconds(),
+			"bytes":           recorder.bytes,
+		}).Printf("%s %s %d", r.Method, r.RequestURI, recorder.code)
 	})
 }
 
@@ -31,38 +86,259 @@ func contentTypeMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// authenticate caller using the bearer identity token
+func authenticationMiddleware(verifier *auth.Verifier) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := auth.TokenFromRequest(r)
+			var identity *auth.Identity
+			if err == nil {
+				identity, err = verifier.Verify(token)
+			}
+
+			if err != nil {
+				helpers.Logger(r.Context()).WithField("request_uri", r.RequestURI).Warnf("Authentication failed: %v", err)
+				apiError := models.NewAPIError(http.StatusUnauthorized, models.ReasonUnauthenticated, err.Error())
+				apiError.RequestID = helpers.RequestID(r.Context())
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, apiError.JSON())
+				return
+			}
+
+			helpers.AddLogFields(r.Context(), logrus.Fields{"caller": identity.String()})
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), identity)))
+		})
+	}
+}
+
+// newVerifier returns a token verifier configured from environment, nil when authentication is disabled
+func newVerifier() (*auth.Verifier, error) {
+	audience := os.Getenv("AUTH_AUDIENCE")
+	if audience == "" {
+		return nil, nil
+	}
+
+	jwks := os.Getenv("AUTH_JWKS")
+	if jwks == "" {
+		jwks = auth.GoogleJWKSURL
+	}
+	keys, err := auth.LoadKeySet(jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	issuers := []string{"https://accounts.google.com", "accounts.google.com"}
+	if value := os.Getenv("AUTH_ISSUERS"); value != "" {
+		issuers = strings.Split(value, ",")
+	}
+
+	return auth.NewVerifier(keys, audience, issuers...), nil
+}
+
 func main() {
+	helpers.InitLogger()
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	r := mux.NewRouter().StrictSlash(true)
-	// Disable http access log on testing
-	if os.Getenv("CI") == "" {
-		r.Use(loggingMiddleware)
+	// Trace requests, continuing traces of callers
+	shutdownTracing, err := tracing.Setup(context.Background(), os.Getenv("OTEL_TRACES_EXPORTER"))
+	if err != nil {
+		logrus.Fatalf("Unable to configure tracing: %v", err)
 	}
+
+	r := mux.NewRouter().StrictSlash(true)
+	r.Use(tracing.Middleware)
 	r.Use(contentTypeMiddleware)
+	r.NotFoundHandler = contentTypeMiddleware(http.HandlerFunc(handlers.NotFoundHandler))
+	r.MethodNotAllowedHandler = contentTypeMiddleware(http.HandlerFunc(handlers.MethodNotAllowedHandler))
 
-	// Manage sets of rules
-	managerRouter := r.PathPrefix("/project/{project}/service_project/{service_project}/application/{application}").Subrouter()
-	managerRouter.Path("").Methods("GET").HandlerFunc(handlers.ListFirewallRuleHandler)
+	// Share a single Google client between requests
+	client, err := models.NewFirewallRuleClient()
+	if err != nil {
+		logrus.Fatalf("Unable to create Google client: %v", err)
+	}
+	manager := metrics.NewManager(tracing.NewManager(client))
+	server := handlers.NewServer(manager)
 
-	// Manage a specific rule
-	ruleRouter := r.PathPrefix("/project/{project}/service_project/{service_project}/application/{application}/firewall_rule/{rule}").Subrouter()
-	ruleRouter.Path("").Methods("POST").HandlerFunc(handlers.CreateFirewallRuleHandler)
-	ruleRouter.Path("").Methods("GET").HandlerFunc(handlers.GetFirewallRuleHandler)
-	ruleRouter.Path("").Methods("DELETE").HandlerFunc(handlers.DeleteFirewallRuleHandler)
+	// Authenticate callers on rules management routes
+	var middlewares []mux.MiddlewareFunc
+	verifier, err := newVerifier()
+	if err != nil {
+		logrus.Fatalf("Unable to configure authentication: %v", err)
+	}
+	if verifier != nil {
+		middlewares = append(middlewares, authenticationMiddleware(verifier))
+	} else {
+		logrus.Warn("AUTH_AUDIENCE is not set, authentication is disabled")
+	}
 
-	r.Path("/_health").Methods("GET").HandlerFunc(handlers.HealthCheckHandler)
+	// Authorize callers on applications
+	if filename := os.Getenv("RBAC_POLICY"); filename != "" {
+		policy, err := rbac.LoadPolicy(filename)
+		if err != nil {
+			logrus.Fatalf("Unable to load RBAC policy: %v", err)
+		}
+		server.Authorizer = policy
+	} else {
+		logrus.Warn("RBAC_POLICY is not set, authorization is disabled")
+	}
 
-	helpers.InitLogger()
+	// Namespace rules tags per application
+	if value := os.Getenv("TAGS_MODE"); value != "" {
+		mode, err := services.ParseTagMode(value)
+		if err != nil {
+			logrus.Fatalf("Unable to configure tags: %v", err)
+		}
+		services.Tags.Mode = mode
+	}
+	if value := os.Getenv("TAGS_EXCEPTIONS"); value != "" {
+		services.Tags.Exceptions = strings.Split(value, ",")
+	}
+
+	// Configure how rules are named
+	if value := os.Getenv("NAMING"); value != "" {
+		naming, err := services.ParseNaming(value)
+		if err != nil {
+			logrus.Fatalf("Unable to configure naming: %v", err)
+		}
+		services.Naming = naming
+	}
+
+	// Limit concurrent calls to Google on operations over a set of rules
+	if value := os.Getenv("PARALLELISM"); value != "" {
+		parallelism, err := strconv.Atoi(value)
+		if err != nil || parallelism < 1 {
+			logrus.Fatalf("PARALLELISM must be a positive integer, got '%s'", value)
+		}
+		services.Parallelism = parallelism
+	}
+
+	// Wait for Google operations
+	if value := os.Getenv("OPERATION_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			logrus.Fatalf("OPERATION_TIMEOUT must be a duration like 2m, got '%s'", value)
+		}
+		models.OperationTimeout = timeout
+	}
+
+	// Bound calls to Google made by a request
+	if value := os.Getenv("REQUEST_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			logrus.Fatalf("REQUEST_TIMEOUT must be a duration like 5m, got '%s'", value)
+		}
+		server.RequestTimeout = timeout
+	}
+
+	// Run acceptance checks on created and updated rules
+	if filename := os.Getenv("POLICY_FILE"); filename != "" {
+		config, err := policy.LoadConfig(filename)
+		if err != nil {
+			logrus.Fatalf("Unable to load acceptance policy: %v", err)
+		}
+		engine, err := config.Engine()
+		if err != nil {
+			logrus.Fatalf("Unable to load acceptance policy: %v", err)
+		}
+		services.Policy = metrics.NewValidator(engine)
+	}
+
+	// Record every change made on rules
+	var sinks audit.Sinks
+	if filename := os.Getenv("AUDIT_FILE"); filename != "" {
+		sink, err := audit.NewFileSink(filename)
+		if err != nil {
+			logrus.Fatalf("Unable to open audit file: %v", err)
+		}
+		defer sink.Close()
+		sinks = append(sinks, sink)
+	}
+	if os.Getenv("AUDIT_STDOUT") == "true" {
+		sinks = append(sinks, audit.NewLoggerSink(os.Stdout))
+	}
+	if len(sinks) > 0 {
+		services.Audit = sinks
+	}
 
+	// Keep revisions of the rule set of applications
+	if filename := os.Getenv("HISTORY_FILE"); filename != "" {
+		store, err := history.NewFileStore(filename)
+		if err != nil {
+			logrus.Fatalf("Unable to open history file: %v", err)
+		}
+		defer store.Close()
+		services.History = store
+	}
+
+	// Record ownership of rules created before it was recorded, for the listed applications
+	if filename := os.Getenv("OWNERSHIP_MIGRATION"); filename != "" {
+		applications, err := services.LoadApplications(filename)
+		if err != nil {
+			logrus.Fatalf("Unable to load applications to migrate: %v", err)
+		}
+		migrationCtx := helpers.WithLogger(context.Background(), logrus.WithField("job", "ownership_migration"))
+		if err := services.MigrateOwnership(migrationCtx, manager, applications); err != nil {
+			logrus.Errorf("Ownership migration failed: %v", err)
+		}
+	}
+
+	server.RegisterRoutes(r, middlewares...)
+	r.Path("/_health").Methods("GET").HandlerFunc(handlers.HealthCheckHandler)
+	r.Path("/metrics").Methods("GET").Handler(metrics.Handler())
+
+	// Cancel in-flight calls to Google on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	server.Context = ctx
+	// Count every request, including those matching no route
+	handler := metrics.InstrumentRouter(r)
+	// Disable http access log on testing
+	if os.Getenv("CI") == "" {
+		handler = loggingMiddleware(handler)
+	}
 	srv := http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: r,
+		Addr:        fmt.Sprintf(":%s", port),
+		Handler:     requestIDMiddleware(handler),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	// Detect drift of applications against their last revision
+	if value := os.Getenv("DRIFT_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			logrus.Fatalf("DRIFT_INTERVAL must be a duration like 10m, got '%s'", value)
+		}
+		if services.History == nil {
+			logrus.Fatal("DRIFT_INTERVAL requires HISTORY_FILE to be set")
+		}
+		driftCtx := helpers.WithLogger(ctx, logrus.WithField("job", "drift"))
+		go services.WatchDrift(driftCtx, manager, interval, services.LogDrift)
 	}
+
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		logrus.Print("Shutting down")
+		cancel()
+		if err := srv.Shutdown(context.Background()); err != nil {
+			logrus.Print(err)
+		}
+		if err := shutdownTracing(context.Background()); err != nil {
+			logrus.Print(err)
+		}
+		close(stopped)
+	}()
+
 	logrus.Printf("Listening on port %s", port)
-	logrus.Print(srv.ListenAndServe())
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		logrus.Fatal(err)
+	}
+	<-stopped
 }
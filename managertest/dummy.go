@@ -0,0 +1,144 @@
+// Package managertest provides an in-memory firewall rule manager for tests.
+package managertest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// FirewallRuleDummyClient provides primitives to collect rules from in-memory rules list. Implements FirewallRuleManager
+type FirewallRuleDummyClient struct {
+	Rules map[string][]*compute.Firewall
+	mutex sync.Mutex
+}
+
+// NewFirewallRuleDummyClient FirewallRuleDummyClient constructor
+func NewFirewallRuleDummyClient() (*FirewallRuleDummyClient, error) {
+	manager := FirewallRuleDummyClient{}
+	manager.Rules = make(map[string][]*compute.Firewall)
+	return &manager, nil
+}
+
+// ListFirewallRule returns given project's firewall rules selected by filter
+func (f *FirewallRuleDummyClient) ListFirewallRule(ctx context.Context, project string, filter models.ListFilter) ([]*compute.Firewall, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if value, ok := f.Rules[project]; ok {
+		rules := []*compute.Firewall{}
+		for _, rule := range value {
+			if filter.Match(rule) {
+				rules = append(rules, rule)
+			}
+		}
+		return rules, nil
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: "Project not found"}
+}
+
+// GetFirewallRule returns firewall rule matching given project and name
+func (f *FirewallRuleDummyClient) GetFirewallRule(ctx context.Context, project, name string) (*compute.Firewall, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, rule := range f.Rules[project] {
+		if rule.Name == name {
+			return rule, nil
+		}
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: "Rule not found"}
+}
+
+// CreateFirewallRule create given firewall rule on given project
+func (f *FirewallRuleDummyClient) CreateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, r := range f.Rules[project] {
+		if r.Name == rule.Name {
+			return nil, &googleapi.Error{Code: http.StatusConflict, Message: "Rule already exists"}
+		}
+	}
+
+	f.Rules[project] = append(f.Rules[project], rule)
+	return rule, nil
+}
+
+// UpdateFirewallRule replace the firewall rule matching rule name on given project
+func (f *FirewallRuleDummyClient) UpdateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i, r := range f.Rules[project] {
+		if r.Name == rule.Name {
+			f.Rules[project][i] = rule
+			return rule, nil
+		}
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: "Rule not found"}
+}
+
+// PatchFirewallRule update only provided fields of the firewall rule matching rule name on given project
+func (f *FirewallRuleDummyClient) PatchFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i, r := range f.Rules[project] {
+		if r.Name == rule.Name {
+			// Merge non-empty fields of the patch on a copy of the existing rule
+			patched, err := models.MergeFirewallRule(r, rule)
+			if err != nil {
+				return nil, err
+			}
+			f.Rules[project][i] = patched
+			return patched, nil
+		}
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: "Rule not found"}
+}
+
+// DeleteFirewallRule delete firewall rule matching given project and name
+func (f *FirewallRuleDummyClient) DeleteFirewallRule(ctx context.Context, project, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	rules := f.Rules[project]
+	for i, rule := range rules {
+		if rule.Name == name {
+			// Delete matching route
+			rules[i] = rules[len(rules)-1]
+			f.Rules[project] = rules[:len(rules)-1]
+			return nil
+		}
+	}
+	return &googleapi.Error{Code: http.StatusNotFound, Message: "Rule not found"}
+}
@@ -0,0 +1,194 @@
+// Package metrics exposes Prometheus metrics of the API, of calls to Google and of acceptance checks.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "firewall_api_http_requests_total",
+		Help: "Count of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "firewall_api_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+	managerCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "firewall_api_manager_calls_total",
+		Help: "Count of calls to the firewall rule manager by method.",
+	}, []string{"method"})
+	managerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "firewall_api_manager_call_duration_seconds",
+		Help:    "Latency of calls to the firewall rule manager by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	managerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "firewall_api_manager_errors_total",
+		Help: "Count of failed calls to the firewall rule manager by method and error code.",
+	}, []string{"method", "code"})
+	policyRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "firewall_api_policy_rejections_total",
+		Help: "Count of acceptance check violations by check.",
+	}, []string{"check"})
+)
+
+func init() {
+	prometheus.MustRegister(requests, requestDuration, managerCalls, managerDuration, managerErrors, policyRejections)
+}
+
+// Handler returns the handler exposing metrics to Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// statusRecorder keeps the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// UnmatchedRoute is the route label of requests matching no route, answered with 404 or 405
+const UnmatchedRoute = "unmatched"
+
+// InstrumentRouter records count and latency of requests served by router, by route template, method and status code.
+// It wraps the whole router so that requests matching no route are counted too
+func InstrumentRouter(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		router.ServeHTTP(recorder, r)
+
+		route := UnmatchedRoute
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.MatchErr == nil && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		code := strconv.Itoa(recorder.code)
+		requests.WithLabelValues(route, r.Method, code).Inc()
+		requestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Manager records count, latency and errors of calls to a FirewallRuleManager. Implements FirewallRuleManager
+type Manager struct {
+	manager models.FirewallRuleManager
+}
+
+// NewManager Manager constructor
+func NewManager(manager models.FirewallRuleManager) *Manager {
+	return &Manager{manager: manager}
+}
+
+// observe records a call to method started at start and ended with err
+func observe(method string, start time.Time, err error) {
+	managerCalls.WithLabelValues(method).Inc()
+	managerDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		managerErrors.WithLabelValues(method, errorCode(err)).Inc()
+	}
+}
+
+// errorCode returns the label of an error returned by the manager
+func errorCode(err error) string {
+	switch value := err.(type) {
+	case *googleapi.Error:
+		return strconv.Itoa(value.Code)
+	case *models.OperationError:
+		return strconv.Itoa(value.Code)
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// ListFirewallRule lists rules through the wrapped manager
+func (m *Manager) ListFirewallRule(ctx context.Context, project string, filter models.ListFilter) ([]*compute.Firewall, error) {
+	start := time.Now()
+	rules, err := m.manager.ListFirewallRule(ctx, project, filter)
+	observe("list", start, err)
+	return rules, err
+}
+
+// GetFirewallRule gets a rule through the wrapped manager
+func (m *Manager) GetFirewallRule(ctx context.Context, project, name string) (*compute.Firewall, error) {
+	start := time.Now()
+	rule, err := m.manager.GetFirewallRule(ctx, project, name)
+	observe("get", start, err)
+	return rule, err
+}
+
+// CreateFirewallRule creates a rule through the wrapped manager
+func (m *Manager) CreateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	start := time.Now()
+	rule, err := m.manager.CreateFirewallRule(ctx, project, rule)
+	observe("create", start, err)
+	return rule, err
+}
+
+// UpdateFirewallRule updates a rule through the wrapped manager
+func (m *Manager) UpdateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	start := time.Now()
+	rule, err := m.manager.UpdateFirewallRule(ctx, project, rule)
+	observe("update", start, err)
+	return rule, err
+}
+
+// PatchFirewallRule patches a rule through the wrapped manager
+func (m *Manager) PatchFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	start := time.Now()
+	rule, err := m.manager.PatchFirewallRule(ctx, project, rule)
+	observe("patch", start, err)
+	return rule, err
+}
+
+// DeleteFirewallRule deletes a rule through the wrapped manager
+func (m *Manager) DeleteFirewallRule(ctx context.Context, project, name string) error {
+	start := time.Now()
+	err := m.manager.DeleteFirewallRule(ctx, project, name)
+	observe("delete", start, err)
+	return err
+}
+
+// Validator counts violations found by a policy Validator. Implements Validator
+type Validator struct {
+	validator policy.Validator
+}
+
+// NewValidator Validator constructor
+func NewValidator(validator policy.Validator) *Validator {
+	return &Validator{validator: validator}
+}
+
+// Validate returns violations found by the wrapped validator
+func (v *Validator) Validate(rule *compute.Firewall) []policy.Violation {
+	violations := v.validator.Validate(rule)
+	for _, violation := range violations {
+		policyRejections.WithLabelValues(violation.Check).Inc()
+	}
+	return violations
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	compute "google.golang.org/api/compute/v1"
+)
+
+type rejectAll struct{}
+
+func (rejectAll) Validate(rule *compute.Firewall) []policy.Violation {
+	return []policy.Violation{{Check: "reject_all", Message: "Every rule is rejected"}}
+}
+
+func TestManager(t *testing.T) {
+	dummy, _ := managertest.NewFirewallRuleDummyClient()
+	manager := NewManager(dummy)
+	ctx := context.Background()
+
+	manager.CreateFirewallRule(ctx, "host", &compute.Firewall{Name: "foo-sp-web-https"})
+	manager.GetFirewallRule(ctx, "host", "foo-sp-web-https")
+	manager.GetFirewallRule(ctx, "host", "unknown")
+	manager.ListFirewallRule(ctx, "host", models.ListFilter{})
+	manager.DeleteFirewallRule(ctx, "host", "foo-sp-web-https")
+
+	for method, expected := range map[string]float64{"create": 1, "get": 2, "list": 1, "delete": 1, "update": 0} {
+		if got := testutil.ToFloat64(managerCalls.WithLabelValues(method)); got != expected {
+			t.Errorf("Got %v %s calls expected %v", got, method, expected)
+		}
+	}
+	if got := testutil.ToFloat64(managerErrors.WithLabelValues("get", "404")); got != 1 {
+		t.Errorf("Got %v get errors expected 1", got)
+	}
+	if len(dummy.Rules["host"]) != 0 {
+		t.Errorf("Expected calls to reach the wrapped manager")
+	}
+}
+
+func TestValidator(t *testing.T) {
+	validator := NewValidator(rejectAll{})
+	if err := policy.Check(validator, &compute.Firewall{}); err == nil {
+		t.Errorf("Expected wrapped violations to be returned")
+	}
+	if got := testutil.ToFloat64(policyRejections.WithLabelValues("reject_all")); got != 1 {
+		t.Errorf("Got %v rejections expected 1", got)
+	}
+}
+
+func TestInstrumentRouter(t *testing.T) {
+	r := mux.NewRouter()
+	r.Path("/project/{project}").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r.Path("/metrics").Methods("GET").Handler(Handler())
+	handler := InstrumentRouter(r)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/project/host", nil))
+	if got := testutil.ToFloat64(requests.WithLabelValues("/project/{project}", "GET", "418")); got != 1 {
+		t.Errorf("Got %v requests expected 1", got)
+	}
+
+	// Requests matching no route are counted under a fixed route
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/unknown", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/project/host", nil))
+	if got := testutil.ToFloat64(requests.WithLabelValues(UnmatchedRoute, "GET", "404")); got != 1 {
+		t.Errorf("Got %v not found requests expected 1", got)
+	}
+	if got := testutil.ToFloat64(requests.WithLabelValues(UnmatchedRoute, "DELETE", "405")); got != 1 {
+		t.Errorf("Got %v method not allowed requests expected 1", got)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `firewall_api_http_request_duration_seconds_count{code="418",method="GET",route="/project/{project}"} 1`) {
+		t.Errorf("Got status %d expected request latency in body %s", rr.Code, rr.Body.String())
+	}
+}
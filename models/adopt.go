@@ -0,0 +1,12 @@
+package models
+
+// Adoption describe an existing rule to assign to an application
+type Adoption struct {
+	// Name is the name of the existing rule
+	Name string `json:"name"`
+	// CustomName is the name of the rule within the application, Name is used when empty
+	CustomName string `json:"custom_name,omitempty"`
+}
+
+// Adoptions describe a set of existing rules to assign to an application
+type Adoptions []Adoption
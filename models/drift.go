@@ -0,0 +1,37 @@
+package models
+
+import "google.golang.org/api/compute/v1"
+
+// DriftStatus describe how a live rule differs from the desired state
+type DriftStatus string
+
+// Drift statuses
+const (
+	// DriftModified rules exist but differ from the desired state
+	DriftModified DriftStatus = "modified"
+	// DriftMissing rules are desired but do not exist
+	DriftMissing DriftStatus = "missing"
+	// DriftUnexpected rules exist but are not desired
+	DriftUnexpected DriftStatus = "unexpected"
+)
+
+// Drift describe a rule which differs from the desired state
+type Drift struct {
+	CustomName string      `json:"custom_name"`
+	Status     DriftStatus `json:"status"`
+	// Changes lists fields of modified rules which differ from the desired state
+	Changes []string          `json:"changes,omitempty"`
+	Desired *compute.Firewall `json:"desired,omitempty"`
+	Actual  *compute.Firewall `json:"actual,omitempty"`
+}
+
+// DriftReport describe the end-user response comparing live rules of an application with its desired state
+type DriftReport struct {
+	Project        string `json:"project"`
+	ServiceProject string `json:"service_project"`
+	Application    string `json:"application"`
+	// Revision is the revision holding the desired state
+	Revision int     `json:"revision"`
+	Drifted  bool    `json:"drifted"`
+	Drifts   []Drift `json:"drifts"`
+}
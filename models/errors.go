@@ -3,30 +3,124 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
 )
 
-// GoogleApplicationError describe a custom error response
-type GoogleApplicationError struct {
+// Error reasons, a machine-readable cause of an APIError
+const (
+	ReasonInvalidArgument  = "invalid_argument"
+	ReasonUnauthenticated  = "unauthenticated"
+	ReasonPermissionDenied = "permission_denied"
+	ReasonNotFound         = "not_found"
+	ReasonAlreadyExists    = "already_exists"
+	ReasonPolicyViolation  = "policy_violation"
+	ReasonUpstream         = "upstream_error"
+	ReasonDeadlineExceeded = "deadline_exceeded"
+	ReasonCanceled         = "canceled"
+	ReasonInternal         = "internal"
+)
+
+// APIError describe the response returned on every failure
+type APIError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	// Field is the offending request field, if any
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Operation and Errors describe a failed Google operation
+	Operation string                          `json:"operation,omitempty"`
+	Errors    []*compute.OperationErrorErrors `json:"errors,omitempty"`
+	// Violations lists failed acceptance checks
+	Violations []policy.Violation `json:"violations,omitempty"`
 }
 
-// NewGoogleApplicationError GoogleApplicationError constructor
-func NewGoogleApplicationError(err *googleapi.Error) *GoogleApplicationError {
-	return &GoogleApplicationError{
-		Code:    err.Code,
-		Message: err.Message,
+// NewAPIError APIError constructor
+func NewAPIError(code int, reason, message string) *APIError {
+	return &APIError{
+		Code:    code,
+		Message: message,
+		Reason:  reason,
 	}
 }
 
-func (g *GoogleApplicationError) Error() string {
-	return fmt.Sprintf("Error from Google: Code %d Message '%s'", g.Code, g.Message)
+// NewGoogleAPIError APIError constructor from a Google error
+func NewGoogleAPIError(err *googleapi.Error) *APIError {
+	return NewAPIError(err.Code, upstreamReason(err.Code), err.Message)
+}
+
+// NewOperationAPIError APIError constructor from a failed Google operation
+func NewOperationAPIError(err *OperationError) *APIError {
+	reason := upstreamReason(err.Code)
+	if err.Code == http.StatusGatewayTimeout {
+		reason = ReasonDeadlineExceeded
+	}
+	apiError := NewAPIError(err.Code, reason, err.Message)
+	apiError.Operation = err.Operation
+	apiError.Errors = err.Errors
+	return apiError
+}
+
+// upstreamReason returns the reason matching the code of a Google error
+func upstreamReason(code int) string {
+	switch code {
+	case http.StatusBadRequest:
+		return ReasonInvalidArgument
+	case http.StatusNotFound:
+		return ReasonNotFound
+	case http.StatusConflict:
+		return ReasonAlreadyExists
+	default:
+		return ReasonUpstream
+	}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Code %d Reason %s Message '%s'", e.Code, e.Reason, e.Message)
 }
 
 // JSON return error as JSON format
-func (g *GoogleApplicationError) JSON() string {
-	res, _ := json.Marshal(g)
+func (e *APIError) JSON() string {
+	res, _ := json.Marshal(e)
 	return string(res)
 }
+
+// OperationError describe a failed or unfinished Compute long-running operation
+type OperationError struct {
+	Code      int                             `json:"code"`
+	Message   string                          `json:"message"`
+	Operation string                          `json:"operation"`
+	Errors    []*compute.OperationErrorErrors `json:"errors,omitempty"`
+}
+
+// NewOperationError OperationError constructor from a done operation
+func NewOperationError(op *compute.Operation) *OperationError {
+	code := int(op.HttpErrorStatusCode)
+	if code == 0 {
+		code = http.StatusInternalServerError
+	}
+
+	message := op.HttpErrorMessage
+	var errors []*compute.OperationErrorErrors
+	if op.Error != nil {
+		errors = op.Error.Errors
+		if len(errors) > 0 {
+			message = errors[0].Message
+		}
+	}
+
+	return &OperationError{
+		Code:      code,
+		Message:   message,
+		Operation: op.Name,
+		Errors:    errors,
+	}
+}
+
+func (o *OperationError) Error() string {
+	return fmt.Sprintf("Error from Google operation %s: Code %d Message '%s'", o.Operation, o.Code, o.Message)
+}
@@ -1,9 +1,9 @@
 package models
 
 import (
-	"fmt"
 	"testing"
 
+	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
 )
 
@@ -13,40 +13,79 @@ type TestCase struct {
 	Got      interface{}
 }
 
-func TestGoogleApplicationError(t *testing.T) {
-	expectedError := *&googleapi.Error{
-		Code:    1234,
-		Message: "dummy",
+func TestGoogleAPIError(t *testing.T) {
+	suite := []TestCase{
+		TestCase{
+			Title:    "Not found Google error keeps code with not found reason",
+			Expected: `{"code":404,"message":"dummy","reason":"not_found"}`,
+			Got:      NewGoogleAPIError(&googleapi.Error{Code: 404, Message: "dummy"}).JSON(),
+		},
+		TestCase{
+			Title:    "Conflicting Google error has already exists reason",
+			Expected: ReasonAlreadyExists,
+			Got:      NewGoogleAPIError(&googleapi.Error{Code: 409, Message: "dummy"}).Reason,
+		},
+		TestCase{
+			Title:    "Other Google errors are upstream errors",
+			Expected: ReasonUpstream,
+			Got:      NewGoogleAPIError(&googleapi.Error{Code: 403, Message: "dummy"}).Reason,
+		},
+		TestCase{
+			Title:    "Error() method should return message as formatted string",
+			Expected: "Code 400 Reason invalid_argument Message 'dummy'",
+			Got:      NewAPIError(400, ReasonInvalidArgument, "dummy").Error(),
+		},
+		TestCase{
+			Title:    "JSON() method should return field and request ID when set",
+			Expected: `{"code":400,"message":"dummy","reason":"invalid_argument","field":"item.priority","request_id":"1234"}`,
+			Got:      (&APIError{Code: 400, Message: "dummy", Reason: ReasonInvalidArgument, Field: "item.priority", RequestID: "1234"}).JSON(),
+		},
+	}
+
+	// Launch test
+	for _, suiteCase := range suite {
+		t.Run(suiteCase.Title, func(t *testing.T) {
+			if suiteCase.Expected != suiteCase.Got {
+				t.Errorf("Got %v want %v", suiteCase.Got, suiteCase.Expected)
+			}
+		})
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	op := compute.Operation{
+		Name:                "operation-1234",
+		Status:              "DONE",
+		HttpErrorStatusCode: 409,
+		HttpErrorMessage:    "CONFLICT",
+		Error: &compute.OperationError{Errors: []*compute.OperationErrorErrors{
+			&compute.OperationErrorErrors{Code: "RESOURCE_ALREADY_EXISTS", Message: "dummy"},
+		}},
 	}
 
 	// Execute function
-	testedError := NewGoogleApplicationError(&expectedError)
+	testedError := NewOperationError(&op)
 
 	suite := []TestCase{
 		TestCase{
-			Title:    "Error should not be nil",
-			Expected: false,
-			Got:      testedError == nil,
-		},
-		TestCase{
-			Title:    "Error code should be identical",
-			Expected: expectedError.Code,
+			Title:    "Error code should be operation HTTP code",
+			Expected: 409,
 			Got:      testedError.Code,
 		},
 		TestCase{
-			Title:    "Error messaage shoud be identical",
-			Expected: expectedError.Message,
+			Title:    "Error message should be first operation error",
+			Expected: "dummy",
 			Got:      testedError.Message,
 		},
 		TestCase{
-			Title:    "Error() method should return message as fromatted string",
-			Expected: fmt.Sprintf("Error from Google: Code %d Message '%s'", expectedError.Code, expectedError.Message),
-			Got:      testedError.Error(),
+			Title:    "API error should keep operation details",
+			Expected: `{"code":409,"message":"dummy","reason":"already_exists","operation":"operation-1234","errors":[{"code":"RESOURCE_ALREADY_EXISTS","message":"dummy"}]}`,
+			Got:      NewOperationAPIError(testedError).JSON(),
 		},
 		TestCase{
-			Title:    "JSON() method should return error as JSON",
-			Expected: `{"code":1234,"message":"dummy"}`,
-			Got:      testedError.JSON(),
+			Title:    "Error code should default to internal error",
+			Expected: 500,
+			Got:      NewOperationError(&compute.Operation{Name: "operation-5678"}).Code,
 		},
 	}
 
@@ -54,7 +93,7 @@ func TestGoogleApplicationError(t *testing.T) {
 	for _, suiteCase := range suite {
 		t.Run(suiteCase.Title, func(t *testing.T) {
 			if suiteCase.Expected != suiteCase.Got {
-				t.Errorf("Got %d want %d", suiteCase.Got, suiteCase.Expected)
+				t.Errorf("Got %v want %v", suiteCase.Got, suiteCase.Expected)
 			}
 		})
 	}
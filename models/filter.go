@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// ListFilter selects rules listed by a FirewallRuleManager. The zero value selects every rule
+type ListFilter struct {
+	// Name is a regular expression matching the whole rule name, any name when empty
+	Name string
+	// Direction is INGRESS or EGRESS, any direction when empty
+	Direction string
+	// Disabled selects disabled or enabled rules, both when nil
+	Disabled *bool
+}
+
+// NamePrefix returns the Name of a filter selecting rules whose name starts with prefix
+func NamePrefix(prefix string) string {
+	return regexp.QuoteMeta(prefix) + ".*"
+}
+
+// Expression returns the filter as a Compute list filter, empty when every rule is selected
+func (f ListFilter) Expression() string {
+	var expressions []string
+	if f.Name != "" {
+		expressions = append(expressions, fmt.Sprintf("(name eq %s)", f.Name))
+	}
+	if f.Direction != "" {
+		expressions = append(expressions, fmt.Sprintf("(direction eq %s)", regexp.QuoteMeta(f.Direction)))
+	}
+	if f.Disabled != nil {
+		expressions = append(expressions, fmt.Sprintf("(disabled eq %t)", *f.Disabled))
+	}
+	return strings.Join(expressions, " ")
+}
+
+// Match returns true when rule is selected by the filter
+func (f ListFilter) Match(rule *compute.Firewall) bool {
+	if f.Name != "" {
+		if matched, err := regexp.MatchString("^(?:"+f.Name+")$", rule.Name); err != nil || !matched {
+			return false
+		}
+	}
+	direction := rule.Direction
+	if direction == "" {
+		direction = "INGRESS"
+	}
+	if f.Direction != "" && !strings.EqualFold(direction, f.Direction) {
+		return false
+	}
+	if f.Disabled != nil && rule.Disabled != *f.Disabled {
+		return false
+	}
+	return true
+}
+
+// RuleQuery selects, sorts and pages rules of an application
+type RuleQuery struct {
+	// Filter is applied by the manager
+	Filter ListFilter
+	// Protocol and Port select rules allowing or denying traffic with this protocol, on this port
+	Protocol string
+	Port     int
+	// SourceRange selects rules having this source range
+	SourceRange string
+	// TargetTag selects rules having this target tag, with or without the application prefix
+	TargetTag string
+	// CustomName is a glob pattern on custom names
+	CustomName string
+	// Sort is the field rules are sorted by, prefixed with '-' for descending order. Custom name when empty
+	Sort string
+	// PageSize is the maximum count of returned rules, every rule when zero
+	PageSize int
+	// PageToken is the NextPageToken of the previous page
+	PageToken string
+}
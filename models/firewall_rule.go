@@ -2,15 +2,30 @@ package models
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
 
-	"golang.org/x/oauth2/google"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 )
 
+// OperationTimeout is the maximum duration to wait for a Compute operation to be done
+var OperationTimeout = 2 * time.Minute
+
+// OperationPollInterval is the duration between two Compute operation status checks
+var OperationPollInterval = time.Second
+
 // FirewallRule descibe a firewall rule
 type FirewallRule struct {
 	Rule       compute.Firewall `json:"item"`
 	CustomName string           `json:"custom_name"`
+	// TargetTags and SourceTags are rule tags as given by the user, without the application prefix
+	TargetTags []string `json:"target_tags,omitempty"`
+	SourceTags []string `json:"source_tags,omitempty"`
 }
 
 // FirewallRules describe a set of firewall rule
@@ -22,14 +37,18 @@ type ApplicationRule struct {
 	ServiceProject string        `json:"service_project"`
 	Application    string        `json:"application"`
 	Rules          FirewallRules `json:"data"`
+	// NextPageToken is set when more rules match a paged query
+	NextPageToken string `json:"next_page_token,omitempty"`
 }
 
 // FirewallRuleManager contains methods to manage firewall rules
 type FirewallRuleManager interface {
-	ListFirewallRule(project string) ([]*compute.Firewall, error)
-	GetFirewallRule(project, name string) (*compute.Firewall, error)
-	CreateFirewallRule(project string, rule *compute.Firewall) (*compute.Firewall, error)
-	DeleteFirewallRule(project, name string) error
+	ListFirewallRule(ctx context.Context, project string, filter ListFilter) ([]*compute.Firewall, error)
+	GetFirewallRule(ctx context.Context, project, name string) (*compute.Firewall, error)
+	CreateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error)
+	UpdateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error)
+	PatchFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error)
+	DeleteFirewallRule(ctx context.Context, project, name string) error
 }
 
 // FirewallRuleClient provides primitives to collect rules from Google Cloud Platform. Implements FirewallRuleManager
@@ -37,15 +56,17 @@ type FirewallRuleClient struct {
 	computeService *compute.Service
 }
 
-// NewFirewallRuleClient FirewallRuleClient contructor
-func NewFirewallRuleClient() (*FirewallRuleClient, error) {
+// NewFirewallRuleClient FirewallRuleClient contructor. Options allow to use another endpoint or credentials,
+// application default credentials are used otherwise. Each call to Google is traced with OpenTelemetry
+func NewFirewallRuleClient(opts ...option.ClientOption) (*FirewallRuleClient, error) {
 	ctx := context.Background()
-	c, err := google.DefaultClient(ctx, compute.CloudPlatformScope)
+	opts = append([]option.ClientOption{option.WithScopes(compute.CloudPlatformScope), option.WithTelemetryDisabled()}, opts...)
+	transport, err := htransport.NewTransport(ctx, otelhttp.NewTransport(http.DefaultTransport), opts...)
 	if err != nil {
 		return nil, err
 	}
-
-	computeService, err := compute.New(c)
+	opts = append(opts, option.WithHTTPClient(&http.Client{Transport: transport}))
+	computeService, err := compute.NewService(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -55,11 +76,12 @@ func NewFirewallRuleClient() (*FirewallRuleClient, error) {
 	return &manager, err
 }
 
-// ListFirewallRule returns given project's firewall rule
-func (f *FirewallRuleClient) ListFirewallRule(project string) ([]*compute.Firewall, error) {
-	ctx := context.Background()
-
+// ListFirewallRule returns given project's firewall rules selected by filter. Filter is applied by Google
+func (f *FirewallRuleClient) ListFirewallRule(ctx context.Context, project string, filter ListFilter) ([]*compute.Firewall, error) {
 	req := f.computeService.Firewalls.List(project)
+	if expression := filter.Expression(); expression != "" {
+		req = req.Filter(expression)
+	}
 
 	var firewallRuleList []*compute.Firewall
 
@@ -75,24 +97,112 @@ func (f *FirewallRuleClient) ListFirewallRule(project string) ([]*compute.Firewa
 }
 
 // GetFirewallRule returns firewall rule matching given project and name
-func (f *FirewallRuleClient) GetFirewallRule(project, name string) (*compute.Firewall, error) {
-	ctx := context.Background()
+func (f *FirewallRuleClient) GetFirewallRule(ctx context.Context, project, name string) (*compute.Firewall, error) {
 	return f.computeService.Firewalls.Get(project, name).Context(ctx).Do()
 
 }
 
 // CreateFirewallRule create given firewall rule on given project
-func (f *FirewallRuleClient) CreateFirewallRule(project string, rule *compute.Firewall) (*compute.Firewall, error) {
-	_, err := f.computeService.Firewalls.Insert(project, rule).Context(context.Background()).Do()
+func (f *FirewallRuleClient) CreateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	op, err := f.computeService.Firewalls.Insert(project, rule).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.waitOperation(ctx, project, op); err != nil {
+		return nil, err
+	}
+
+	return f.GetFirewallRule(ctx, project, rule.Name)
+}
+
+// UpdateFirewallRule replace the firewall rule matching rule name on given project
+func (f *FirewallRuleClient) UpdateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	op, err := f.computeService.Firewalls.Update(project, rule.Name, rule).Context(ctx).Do()
 	if err != nil {
 		return nil, err
 	}
+	if err := f.waitOperation(ctx, project, op); err != nil {
+		return nil, err
+	}
 
-	return f.GetFirewallRule(project, rule.Name)
+	return f.GetFirewallRule(ctx, project, rule.Name)
+}
+
+// PatchFirewallRule update only provided fields of the firewall rule matching rule name on given project
+func (f *FirewallRuleClient) PatchFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	op, err := f.computeService.Firewalls.Patch(project, rule.Name, rule).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.waitOperation(ctx, project, op); err != nil {
+		return nil, err
+	}
+
+	return f.GetFirewallRule(ctx, project, rule.Name)
 }
 
 // DeleteFirewallRule delete firewall rule matching given project and name
-func (f *FirewallRuleClient) DeleteFirewallRule(project string, name string) error {
-	_, err := f.computeService.Firewalls.Delete(project, name).Context(context.Background()).Do()
-	return err
+func (f *FirewallRuleClient) DeleteFirewallRule(ctx context.Context, project string, name string) error {
+	op, err := f.computeService.Firewalls.Delete(project, name).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return f.waitOperation(ctx, project, op)
+}
+
+// waitOperation polls given global operation until it is done and returns its error, if any.
+// The error of parent context is returned when it is done before the operation.
+func (f *FirewallRuleClient) waitOperation(parent context.Context, project string, op *compute.Operation) error {
+	ctx, cancel := context.WithTimeout(parent, OperationTimeout)
+	defer cancel()
+
+	timeout := &OperationError{
+		Code:      http.StatusGatewayTimeout,
+		Message:   fmt.Sprintf("Operation is not done after %s", OperationTimeout),
+		Operation: op.Name,
+	}
+
+	for op.Status != "DONE" {
+		select {
+		case <-ctx.Done():
+			if err := parent.Err(); err != nil {
+				return err
+			}
+			return timeout
+		case <-time.After(OperationPollInterval):
+		}
+
+		var err error
+		op, err = f.computeService.GlobalOperations.Get(project, op.Name).Context(ctx).Do()
+		if err != nil {
+			if err := parent.Err(); err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return timeout
+			}
+			return err
+		}
+	}
+
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		return NewOperationError(op)
+	}
+	return nil
+}
+
+// MergeFirewallRule returns a copy of existing rule overwritten by non-empty fields of patch, as Google does on patch
+func MergeFirewallRule(existing, patch *compute.Firewall) (*compute.Firewall, error) {
+	// Decode both rules in a new one so that existing rule slices are never shared
+	var merged compute.Firewall
+	for _, rule := range []*compute.Firewall{existing, patch} {
+		data, err := json.Marshal(rule)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &merged); err != nil {
+			return nil, err
+		}
+	}
+	return &merged, nil
 }
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/computetest"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// newTestClient returns a client talking to a fake Compute API server
+func newTestClient(t *testing.T) (*FirewallRuleClient, *computetest.Server) {
+	server := computetest.NewServer()
+	client, err := NewFirewallRuleClient(server.ClientOptions()...)
+	if err != nil {
+		server.Close()
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	return client, server
+}
+
+func googleCode(err error) int {
+	if value, ok := err.(*googleapi.Error); ok {
+		return value.Code
+	}
+	return 0
+}
+
+func TestFirewallRuleClient(t *testing.T) {
+	defer func(interval time.Duration) { OperationPollInterval = interval }(OperationPollInterval)
+	OperationPollInterval = time.Millisecond
+
+	client, server := newTestClient(t)
+	defer server.Close()
+	server.PendingPolls = 2
+	ctx := context.Background()
+	project := "host-project"
+
+	// Create waits for the operation and returns the rule as stored by Google
+	rule := &compute.Firewall{Name: "foo-sp-web-allow-https", Allowed: []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"443"}}}, TargetTags: []string{"web"}}
+	created, err := client.CreateFirewallRule(ctx, project, rule)
+	if err != nil {
+		t.Fatalf("Unexpected error during create. Got %v", err)
+	}
+	if created.Id == 0 || created.Priority != 1000 {
+		t.Errorf("Got rule %+v expected output only fields and defaults to be set", created)
+	}
+
+	_, err = client.CreateFirewallRule(ctx, project, rule)
+	if googleCode(err) != http.StatusConflict {
+		t.Errorf("Got error %v expected a %d Google error", err, http.StatusConflict)
+	}
+
+	// Patch keeps omitted fields, update replaces them
+	patched, err := client.PatchFirewallRule(ctx, project, &compute.Firewall{Name: rule.Name, Priority: 900})
+	if err != nil {
+		t.Fatalf("Unexpected error during patch. Got %v", err)
+	}
+	if patched.Priority != 900 || len(patched.TargetTags) != 1 {
+		t.Errorf("Got rule %+v expected priority to be patched and target tags to be kept", patched)
+	}
+
+	updated, err := client.UpdateFirewallRule(ctx, project, &compute.Firewall{Name: rule.Name, Allowed: rule.Allowed})
+	if err != nil {
+		t.Fatalf("Unexpected error during update. Got %v", err)
+	}
+	if updated.Priority != 1000 || len(updated.TargetTags) != 0 {
+		t.Errorf("Got rule %+v expected omitted fields to be reset", updated)
+	}
+
+	_, err = client.UpdateFirewallRule(ctx, project, &compute.Firewall{Name: "unknown"})
+	if googleCode(err) != http.StatusNotFound {
+		t.Errorf("Got error %v expected a %d Google error", err, http.StatusNotFound)
+	}
+
+	// Delete removes the rule
+	if err := client.DeleteFirewallRule(ctx, project, rule.Name); err != nil {
+		t.Fatalf("Unexpected error during delete. Got %v", err)
+	}
+	_, err = client.GetFirewallRule(ctx, project, rule.Name)
+	if googleCode(err) != http.StatusNotFound {
+		t.Errorf("Got error %v expected a %d Google error", err, http.StatusNotFound)
+	}
+	if err := client.DeleteFirewallRule(ctx, project, rule.Name); googleCode(err) != http.StatusNotFound {
+		t.Errorf("Got error %v expected a %d Google error", err, http.StatusNotFound)
+	}
+}
+
+func TestFirewallRuleClientList(t *testing.T) {
+	client, server := newTestClient(t)
+	defer server.Close()
+	server.PageSize = 2
+
+	for i := 0; i < 5; i++ {
+		server.AddFirewall("host-project", &compute.Firewall{Name: fmt.Sprintf("rule-%d", i)})
+	}
+
+	// Every page is collected
+	rules, err := client.ListFirewallRule(context.Background(), "host-project", ListFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error during list. Got %v", err)
+	}
+	if len(rules) != 5 {
+		t.Errorf("Got %d rules expected %d", len(rules), 5)
+	}
+}
+
+func TestFirewallRuleClientListFilter(t *testing.T) {
+	client, server := newTestClient(t)
+	defer server.Close()
+
+	server.AddFirewall("host-project", &compute.Firewall{Name: "ingress"})
+	server.AddFirewall("host-project", &compute.Firewall{Name: "egress", Direction: "EGRESS"})
+	server.AddFirewall("host-project", &compute.Firewall{Name: "disabled-egress", Direction: "EGRESS", Disabled: true})
+
+	enabled := false
+	filter := ListFilter{Direction: "EGRESS", Disabled: &enabled}
+	if expression := filter.Expression(); expression != "(direction eq EGRESS) (disabled eq false)" {
+		t.Errorf("Got expression %s", expression)
+	}
+
+	// Only selected rules are returned by Google
+	rules, err := client.ListFirewallRule(context.Background(), "host-project", filter)
+	if err != nil {
+		t.Fatalf("Unexpected error during list. Got %v", err)
+	}
+	if len(rules) != 1 || rules[0].Name != "egress" || !filter.Match(rules[0]) {
+		t.Errorf("Got rules %+v expected only egress", rules)
+	}
+	if filter.Match(&compute.Firewall{Name: "ingress"}) {
+		t.Errorf("Expected rule without direction to be an ingress rule")
+	}
+
+	// Names are matched as a whole
+	server.AddFirewall("host-project", &compute.Firewall{Name: "foo-sp-web-https"})
+	server.AddFirewall("host-project", &compute.Firewall{Name: "foo-sp-web2-https"})
+	filter = ListFilter{Name: NamePrefix("foo-sp-web-")}
+	rules, err = client.ListFirewallRule(context.Background(), "host-project", filter)
+	if err != nil {
+		t.Fatalf("Unexpected error during list. Got %v", err)
+	}
+	if len(rules) != 1 || rules[0].Name != "foo-sp-web-https" {
+		t.Errorf("Got rules %+v expected only foo-sp-web-https", rules)
+	}
+	if filter.Match(&compute.Firewall{Name: "bar-foo-sp-web-https"}) {
+		t.Errorf("Expected name prefix to match from the start")
+	}
+}
+
+func TestFirewallRuleClientOperationTimeout(t *testing.T) {
+	defer func(timeout, interval time.Duration) {
+		OperationTimeout, OperationPollInterval = timeout, interval
+	}(OperationTimeout, OperationPollInterval)
+	OperationTimeout, OperationPollInterval = 20*time.Millisecond, time.Millisecond
+
+	client, server := newTestClient(t)
+	defer server.Close()
+	server.PendingPolls = 1000
+
+	// Unfinished operation is reported as a timeout
+	_, err := client.CreateFirewallRule(context.Background(), "host-project", &compute.Firewall{Name: "slow"})
+	operationError, ok := err.(*OperationError)
+	if !ok || operationError.Code != http.StatusGatewayTimeout {
+		t.Errorf("Got error %v expected an operation timeout", err)
+	}
+
+	// Canceled caller gets the context error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.DeleteFirewallRule(ctx, "host-project", "slow"); err == nil {
+		t.Errorf("Expected error on canceled context")
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	ownership := Ownership{ServiceProject: "foo-sp", Application: "web", CustomName: "allow-https"}
+	rule := &compute.Firewall{Description: "Public website"}
+
+	if _, ok := RuleOwnership(rule); ok {
+		t.Errorf("Expected rule without ownership")
+	}
+
+	// Ownership is replaced, user description is kept
+	SetOwnership(rule, Ownership{ServiceProject: "bar-sp"})
+	SetOwnership(rule, ownership)
+	if got, ok := RuleOwnership(rule); !ok || got != ownership {
+		t.Errorf("Got ownership %+v expected %+v", got, ownership)
+	}
+	if !strings.HasPrefix(rule.Description, "Public website\n") || strings.Count(rule.Description, ownershipMarker) != 1 {
+		t.Errorf("Got description %q", rule.Description)
+	}
+}
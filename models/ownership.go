@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// ownershipMarker starts the line of a rule description holding the Ownership of the rule
+const ownershipMarker = "managed-by: iwc-gcp-firewall-api "
+
+// Ownership describe the application owning a rule. It is stored in the rule description
+type Ownership struct {
+	ServiceProject string `json:"service_project"`
+	Application    string `json:"application"`
+	CustomName     string `json:"custom_name"`
+}
+
+// SetOwnership stores ownership in the description of rule, after the description given by the user
+func SetOwnership(rule *compute.Firewall, ownership Ownership) {
+	data, _ := json.Marshal(ownership)
+	description := stripOwnership(rule.Description)
+	if description != "" {
+		description += "\n"
+	}
+	rule.Description = description + ownershipMarker + string(data)
+}
+
+// RuleOwnership returns the ownership stored in the description of rule, false when rule has none
+func RuleOwnership(rule *compute.Firewall) (Ownership, bool) {
+	var ownership Ownership
+	i := ownershipIndex(rule.Description)
+	if i < 0 {
+		return ownership, false
+	}
+	err := json.Unmarshal([]byte(rule.Description[i+len(ownershipMarker):]), &ownership)
+	return ownership, err == nil
+}
+
+// stripOwnership returns description without ownership
+func stripOwnership(description string) string {
+	if i := ownershipIndex(description); i >= 0 {
+		return strings.TrimSuffix(description[:i], "\n")
+	}
+	return description
+}
+
+// ownershipIndex returns the index of the ownership line of description, -1 when there is none
+func ownershipIndex(description string) int {
+	if strings.HasPrefix(description, ownershipMarker) {
+		return 0
+	}
+	if i := strings.LastIndex(description, "\n"+ownershipMarker); i >= 0 {
+		return i + 1
+	}
+	return -1
+}
@@ -0,0 +1,26 @@
+package models
+
+import "google.golang.org/api/compute/v1"
+
+// PlanAction describe a change which would be made on a firewall rule
+type PlanAction struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	// Rule is the rule as it would be sent to Google
+	Rule *compute.Firewall `json:"rule,omitempty"`
+	// Current is the rule as it exists before the change
+	Current *compute.Firewall `json:"current,omitempty"`
+	// Changes lists fields which would be modified
+	Changes []string `json:"changes,omitempty"`
+}
+
+// Plan describe the end-user response of a dry run
+type Plan struct {
+	Project        string       `json:"project"`
+	ServiceProject string       `json:"service_project"`
+	Application    string       `json:"application"`
+	DryRun         bool         `json:"dry_run"`
+	Actions        []PlanAction `json:"actions"`
+	// Result is the response which would be returned without dry run
+	Result interface{} `json:"result,omitempty"`
+}
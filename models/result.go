@@ -0,0 +1,52 @@
+package models
+
+import "github.com/adeo/iwc-gcp-firewall-api/policy"
+
+// RuleStatus describe the outcome of an operation on a single rule
+type RuleStatus string
+
+// Rule statuses
+const (
+	RuleStatusCreated    RuleStatus = "created"
+	RuleStatusUpdated    RuleStatus = "updated"
+	RuleStatusDeleted    RuleStatus = "deleted"
+	RuleStatusUnchanged  RuleStatus = "unchanged"
+	RuleStatusConflict   RuleStatus = "conflict"
+	RuleStatusInvalid    RuleStatus = "invalid"
+	RuleStatusError      RuleStatus = "error"
+	RuleStatusSkipped    RuleStatus = "skipped"
+	RuleStatusRolledBack RuleStatus = "rolled_back"
+	RuleStatusAdopted    RuleStatus = "adopted"
+)
+
+// RuleResult describe the result of an operation on a single rule
+type RuleResult struct {
+	CustomName string        `json:"custom_name"`
+	Status     RuleStatus    `json:"status"`
+	Rule       *FirewallRule `json:"rule,omitempty"`
+	// AdoptedFrom is the name of the existing rule recreated for the application
+	AdoptedFrom string `json:"adopted_from,omitempty"`
+	// Changes lists fields modified by an update
+	Changes []string `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	// Violations lists failed acceptance checks of invalid rules
+	Violations []policy.Violation `json:"violations,omitempty"`
+}
+
+// ApplicationResult describe the end-user response of an operation on a set of rules
+type ApplicationResult struct {
+	Project        string       `json:"project"`
+	ServiceProject string       `json:"service_project"`
+	Application    string       `json:"application"`
+	Results        []RuleResult `json:"results"`
+}
+
+// Failed returns true when at least one rule operation did not succeed
+func (a *ApplicationResult) Failed() bool {
+	for _, result := range a.Results {
+		if result.Error != "" {
+			return true
+		}
+	}
+	return false
+}
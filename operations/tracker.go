@@ -0,0 +1,102 @@
+package operations
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Operation statuses
+const (
+	StatusRunning = "RUNNING"
+	StatusDone    = "DONE"
+)
+
+// Retention is the duration done operations are kept
+var Retention = time.Hour
+
+// Operation describe an API call run in background
+type Operation struct {
+	ID        string          `json:"id"`
+	Status    string          `json:"status"`
+	Caller    string          `json:"caller,omitempty"`
+	StartTime time.Time       `json:"start_time"`
+	EndTime   *time.Time      `json:"end_time,omitempty"`
+	Result    interface{}     `json:"result,omitempty"`
+	Error     json.RawMessage `json:"error,omitempty"`
+}
+
+// Tracker keeps operations run in background in memory
+type Tracker struct {
+	mutex      sync.Mutex
+	operations map[string]*Operation
+}
+
+// NewTracker Tracker constructor
+func NewTracker() *Tracker {
+	return &Tracker{operations: make(map[string]*Operation)}
+}
+
+// Start runs fn in background and returns the running operation.
+// Errors returned by fn are rendered with renderError.
+func (t *Tracker) Start(caller string, fn func() (interface{}, error), renderError func(error) json.RawMessage) Operation {
+	op := &Operation{
+		ID:        newID(),
+		Status:    StatusRunning,
+		Caller:    caller,
+		StartTime: time.Now().UTC(),
+	}
+
+	t.mutex.Lock()
+	t.purge()
+	t.operations[op.ID] = op
+	started := *op
+	t.mutex.Unlock()
+
+	go func() {
+		result, err := fn()
+
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		end := time.Now().UTC()
+		op.EndTime = &end
+		op.Status = StatusDone
+		op.Result = result
+		if err != nil {
+			op.Result = nil
+			op.Error = renderError(err)
+		}
+	}()
+
+	return started
+}
+
+// Get returns a copy of the operation matching given ID
+func (t *Tracker) Get(id string) (Operation, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	op, ok := t.operations[id]
+	if !ok {
+		return Operation{}, false
+	}
+	return *op, true
+}
+
+// purge forgets operations done for longer than Retention. Tracker must be locked
+func (t *Tracker) purge() {
+	for id, op := range t.operations {
+		if op.EndTime != nil && time.Since(*op.EndTime) > Retention {
+			delete(t.operations, id)
+		}
+	}
+}
+
+// newID returns a random operation ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
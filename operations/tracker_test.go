@@ -0,0 +1,71 @@
+package operations
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func renderError(err error) json.RawMessage {
+	res, _ := json.Marshal(map[string]string{"message": err.Error()})
+	return res
+}
+
+// waitDone polls tracker until operation is done
+func waitDone(t *testing.T, tracker *Tracker, id string) Operation {
+	for i := 0; i < 100; i++ {
+		op, ok := tracker.Get(id)
+		if !ok {
+			t.Fatalf("Operation %s not found", id)
+		}
+		if op.Status == StatusDone {
+			return op
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Operation %s is not done", id)
+	return Operation{}
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+	release := make(chan struct{})
+
+	// Successful operation
+	op := tracker.Start("alice@example.com", func() (interface{}, error) {
+		<-release
+		return "created", nil
+	}, renderError)
+	if op.Status != StatusRunning || op.ID == "" {
+		t.Errorf("Expected running operation with ID. Got %v", op)
+	}
+	close(release)
+
+	done := waitDone(t, tracker, op.ID)
+	if done.Result != "created" || done.Error != nil || done.EndTime == nil {
+		t.Errorf("Bad done operation. Got %v", done)
+	}
+
+	// Failed operation
+	op = tracker.Start("alice@example.com", func() (interface{}, error) {
+		return nil, fmt.Errorf("boom")
+	}, renderError)
+	done = waitDone(t, tracker, op.ID)
+	if string(done.Error) != `{"message":"boom"}` {
+		t.Errorf("Bad error. Got %s", done.Error)
+	}
+
+	// Unknown operation
+	if _, ok := tracker.Get("unknown"); ok {
+		t.Errorf("Expected unknown operation to be missing")
+	}
+
+	// Old operations are purged
+	Retention = 0
+	defer func() { Retention = time.Hour }()
+	tracker.Start("alice@example.com", func() (interface{}, error) { return nil, nil }, renderError)
+	if _, ok := tracker.Get(done.ID); ok {
+		t.Errorf("Expected done operation to be purged")
+	}
+}
@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// Default priority set by Google when rule priority is omitted
+const defaultPriority = 1000
+
+// portRange describe an inclusive range of ports
+type portRange struct {
+	From int
+	To   int
+}
+
+func (p portRange) String() string {
+	if p.From == p.To {
+		return strconv.Itoa(p.From)
+	}
+	return fmt.Sprintf("%d-%d", p.From, p.To)
+}
+
+// allPorts is the range used by Google when no port is given
+var allPorts = portRange{From: 0, To: 65535}
+
+// parsePortRange decodes ports formatted as `22` or `8000-8080`
+func parsePortRange(value string) (portRange, error) {
+	bounds := strings.SplitN(value, "-", 2)
+	from, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return portRange{}, fmt.Errorf("bad port '%s'", value)
+	}
+	to := from
+	if len(bounds) == 2 {
+		to, err = strconv.Atoi(bounds[1])
+		if err != nil {
+			return portRange{}, fmt.Errorf("bad port '%s'", value)
+		}
+	}
+	if from < 0 || to > 65535 || from > to {
+		return portRange{}, fmt.Errorf("bad port '%s'", value)
+	}
+	return portRange{From: from, To: to}, nil
+}
+
+// allowedRanges returns port ranges opened by an allowed entry. Malformed ports are ignored
+func allowedRanges(allowed *compute.FirewallAllowed) []portRange {
+	if len(allowed.Ports) == 0 {
+		return []portRange{allPorts}
+	}
+	var ranges []portRange
+	for _, p := range allowed.Ports {
+		if r, err := parsePortRange(p); err == nil {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+// protocolNames are names of port based protocols, which Google also accepts by number
+var protocolNames = map[string]string{"6": "tcp", "17": "udp", "132": "sctp"}
+
+// protocolName returns the lowercase name of protocol, given by name or number
+func protocolName(protocol string) string {
+	if name, ok := protocolNames[protocol]; ok {
+		return name
+	}
+	return strings.ToLower(protocol)
+}
+
+// hasPorts returns true when protocol is port based
+func hasPorts(protocol string) bool {
+	switch protocolName(protocol) {
+	case "tcp", "udp", "sctp", "all":
+		return true
+	}
+	return false
+}
+
+// isIngress returns true for ingress rules, which is the default direction
+func isIngress(rule *compute.Firewall) bool {
+	return rule.Direction == "" || strings.EqualFold(rule.Direction, "INGRESS")
+}
+
+// AdminPortsCheck refuses ingress rules opening administration ports to the whole internet
+type AdminPortsCheck struct {
+	Ports []portRange
+}
+
+// Validate implements Validator
+func (c *AdminPortsCheck) Validate(rule *compute.Firewall) []Violation {
+	if !isIngress(rule) {
+		return nil
+	}
+
+	var world string
+	for _, source := range rule.SourceRanges {
+		if source == "0.0.0.0/0" || source == "::/0" {
+			world = source
+			break
+		}
+	}
+	// Google allows every source to ingress rules without any source
+	if len(rule.SourceRanges) == 0 && len(rule.SourceTags) == 0 && len(rule.SourceServiceAccounts) == 0 {
+		world = "0.0.0.0/0"
+	}
+	if world == "" {
+		return nil
+	}
+
+	var violations []Violation
+	for i, allowed := range rule.Allowed {
+		if !hasPorts(allowed.IPProtocol) {
+			continue
+		}
+		for _, opened := range allowedRanges(allowed) {
+			for _, admin := range c.Ports {
+				if opened.From <= admin.To && admin.From <= opened.To {
+					violations = append(violations, Violation{
+						Check:   "admin_ports",
+						Field:   fmt.Sprintf("allowed[%d].ports", i),
+						Message: fmt.Sprintf("Administration port %s must not be opened to %s", admin, world),
+					})
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// PortRangeCheck refuses port ranges wider than MaxWidth ports
+type PortRangeCheck struct {
+	MaxWidth int
+}
+
+// Validate implements Validator
+func (c *PortRangeCheck) Validate(rule *compute.Firewall) []Violation {
+	var violations []Violation
+	for i, allowed := range rule.Allowed {
+		if !hasPorts(allowed.IPProtocol) {
+			continue
+		}
+		if len(allowed.Ports) == 0 {
+			violations = append(violations, Violation{
+				Check:   "max_port_range",
+				Field:   fmt.Sprintf("allowed[%d].ports", i),
+				Message: fmt.Sprintf("Ports must be set, all ports is wider than %d ports", c.MaxWidth),
+			})
+			continue
+		}
+		for _, p := range allowed.Ports {
+			r, err := parsePortRange(p)
+			if err != nil {
+				violations = append(violations, Violation{
+					Check:   "max_port_range",
+					Field:   fmt.Sprintf("allowed[%d].ports", i),
+					Message: fmt.Sprintf("Port range '%s' is malformed", p),
+				})
+				continue
+			}
+			if width := r.To - r.From + 1; width > c.MaxWidth {
+				violations = append(violations, Violation{
+					Check:   "max_port_range",
+					Field:   fmt.Sprintf("allowed[%d].ports", i),
+					Message: fmt.Sprintf("Port range %s opens %d ports, maximum is %d", r, width, c.MaxWidth),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// ProtocolCheck refuses allowed protocols not listed in Protocols
+type ProtocolCheck struct {
+	Protocols []string
+}
+
+// Validate implements Validator
+func (c *ProtocolCheck) Validate(rule *compute.Firewall) []Violation {
+	var violations []Violation
+	for i, allowed := range rule.Allowed {
+		found := false
+		for _, protocol := range c.Protocols {
+			if protocolName(protocol) == protocolName(allowed.IPProtocol) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violations = append(violations, Violation{
+				Check:   "allowed_protocols",
+				Field:   fmt.Sprintf("allowed[%d].IPProtocol", i),
+				Message: fmt.Sprintf("Protocol '%s' is not allowed, expected one of %s", allowed.IPProtocol, strings.Join(c.Protocols, ", ")),
+			})
+		}
+	}
+	return violations
+}
+
+// TargetCheck refuses rules applying to every instance of the network
+type TargetCheck struct{}
+
+// Validate implements Validator
+func (c *TargetCheck) Validate(rule *compute.Firewall) []Violation {
+	if len(rule.TargetTags) == 0 && len(rule.TargetServiceAccounts) == 0 {
+		return []Violation{Violation{
+			Check:   "require_target",
+			Field:   "targetTags",
+			Message: "Rule must set targetTags or targetServiceAccounts",
+		}}
+	}
+	return nil
+}
+
+// PriorityCheck refuses priorities out of [Min, Max]
+type PriorityCheck struct {
+	Min int64
+	Max int64
+}
+
+// Validate implements Validator
+func (c *PriorityCheck) Validate(rule *compute.Firewall) []Violation {
+	priority := rule.Priority
+	if priority == 0 {
+		priority = defaultPriority
+	}
+	if priority < c.Min || priority > c.Max {
+		return []Violation{Violation{
+			Check:   "priority",
+			Field:   "priority",
+			Message: fmt.Sprintf("Priority %d is out of range [%d, %d]", priority, c.Min, c.Max),
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+type TestCase struct {
+	Title      string
+	Rule       compute.Firewall
+	Violations int
+}
+
+const testConfig = `
+admin_ports: ["22", "3389"]
+max_port_range: 100
+allowed_protocols: ["tcp", "udp", "icmp"]
+require_target: true
+priority:
+  min: 1000
+  max: 2000
+`
+
+func loadTestEngine(t *testing.T) Engine {
+	f, err := ioutil.TempFile("", "policy-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(testConfig); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	config, err := LoadConfig(f.Name())
+	if err != nil {
+		t.Fatalf("Unexpected error during configuration loading. Got %v\n", err)
+	}
+	engine, err := config.Engine()
+	if err != nil {
+		t.Fatalf("Unexpected error during engine creation. Got %v\n", err)
+	}
+	return engine
+}
+
+func TestEngine(t *testing.T) {
+	engine := loadTestEngine(t)
+
+	tcp := func(ports ...string) []*compute.FirewallAllowed {
+		return []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: ports}}
+	}
+
+	suite := []TestCase{
+		TestCase{
+			Title:      "Valid rule",
+			Rule:       compute.Firewall{Allowed: tcp("443"), SourceRanges: []string{"0.0.0.0/0"}, TargetTags: []string{"web"}},
+			Violations: 0,
+		},
+		TestCase{
+			Title:      "SSH opened to internet",
+			Rule:       compute.Firewall{Allowed: tcp("22"), SourceRanges: []string{"0.0.0.0/0"}, TargetTags: []string{"web"}},
+			Violations: 1,
+		},
+		TestCase{
+			Title:      "SSH opened without source",
+			Rule:       compute.Firewall{Allowed: tcp("22"), TargetTags: []string{"web"}},
+			Violations: 1,
+		},
+		TestCase{
+			Title:      "SSH opened to internet by protocol number",
+			Rule:       compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "6", Ports: []string{"22"}}}, SourceRanges: []string{"0.0.0.0/0"}, TargetTags: []string{"web"}},
+			Violations: 1,
+		},
+		TestCase{
+			Title:      "SSH opened without source by protocol number",
+			Rule:       compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "6", Ports: []string{"22"}}}, TargetTags: []string{"web"}},
+			Violations: 1,
+		},
+		TestCase{
+			Title:      "All UDP ports by protocol number",
+			Rule:       compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "17"}}, SourceRanges: []string{"10.0.0.0/8"}, TargetTags: []string{"web"}},
+			Violations: 1,
+		},
+		TestCase{
+			Title:      "Wide SCTP range by protocol number",
+			Rule:       compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "132", Ports: []string{"1-65535"}}}, SourceRanges: []string{"10.0.0.0/8"}, TargetTags: []string{"web"}},
+			Violations: 2,
+		},
+		TestCase{
+			Title:      "SSH opened to source tags",
+			Rule:       compute.Firewall{Allowed: tcp("22"), SourceTags: []string{"bastion"}, TargetTags: []string{"web"}},
+			Violations: 0,
+		},
+		TestCase{
+			Title:      "SSH opened to internal range",
+			Rule:       compute.Firewall{Allowed: tcp("22"), SourceRanges: []string{"10.0.0.0/8"}, TargetTags: []string{"web"}},
+			Violations: 0,
+		},
+		TestCase{
+			Title:      "SSH opened to internet on egress",
+			Rule:       compute.Firewall{Direction: "EGRESS", Allowed: tcp("22"), DestinationRanges: []string{"0.0.0.0/0"}, SourceRanges: []string{"0.0.0.0/0"}, TargetTags: []string{"web"}},
+			Violations: 0,
+		},
+		TestCase{
+			Title:      "Wide range to internet covering RDP",
+			Rule:       compute.Firewall{Allowed: tcp("3000-4000"), SourceRanges: []string{"0.0.0.0/0"}, TargetTags: []string{"web"}},
+			Violations: 2,
+		},
+		TestCase{
+			Title:      "All ports",
+			Rule:       compute.Firewall{Allowed: tcp(), SourceRanges: []string{"10.0.0.0/8"}, TargetTags: []string{"web"}},
+			Violations: 1,
+		},
+		TestCase{
+			Title:      "Forbidden protocol",
+			Rule:       compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "esp"}}, TargetTags: []string{"vpn"}},
+			Violations: 1,
+		},
+		TestCase{
+			Title:      "Missing target",
+			Rule:       compute.Firewall{Allowed: tcp("443")},
+			Violations: 1,
+		},
+		TestCase{
+			Title:      "Target service account",
+			Rule:       compute.Firewall{Allowed: tcp("443"), TargetServiceAccounts: []string{"web@project.iam.gserviceaccount.com"}},
+			Violations: 0,
+		},
+		TestCase{
+			Title:      "Priority out of range",
+			Rule:       compute.Firewall{Allowed: tcp("443"), TargetTags: []string{"web"}, Priority: 100},
+			Violations: 1,
+		},
+		TestCase{
+			Title:      "Every failed check is reported",
+			Rule:       compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "all"}}, SourceRanges: []string{"0.0.0.0/0"}, Priority: 10},
+			Violations: 6,
+		},
+	}
+
+	for _, suiteCase := range suite {
+		t.Run(suiteCase.Title, func(t *testing.T) {
+			violations := engine.Validate(&suiteCase.Rule)
+			if len(violations) != suiteCase.Violations {
+				t.Errorf("Bad violations count. Got %d expected %d: %v", len(violations), suiteCase.Violations, violations)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	engine := Engine{&TargetCheck{}, &PriorityCheck{Min: 1000, Max: 1000}}
+
+	err := Check(engine, &compute.Firewall{Priority: 1})
+	violationError, ok := err.(*ViolationError)
+	if !ok {
+		t.Fatalf("Expected ViolationError. Got %v", err)
+	}
+
+	if len(violationError.Violations) != 2 || violationError.Violations[1].Field != "priority" {
+		t.Errorf("Bad violations. Got %+v", violationError.Violations)
+	}
+	if violationError.Error() != "Rule violates 2 acceptance check(s)" {
+		t.Errorf("Bad message. Got %s", violationError.Error())
+	}
+
+	// Nil validator accept every rule
+	if err := Check(nil, &compute.Firewall{}); err != nil {
+		t.Errorf("Expected no error without validator. Got %v", err)
+	}
+}
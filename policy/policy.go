@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/api/compute/v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Violation describe a failed acceptance check
+type Violation struct {
+	Check   string `json:"check"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Validator checks a firewall rule against acceptance criteria
+type Validator interface {
+	Validate(rule *compute.Firewall) []Violation
+}
+
+// Engine runs every validator and collects all violations. Implements Validator
+type Engine []Validator
+
+// Validate returns violations of every validator
+func (e Engine) Validate(rule *compute.Firewall) []Violation {
+	var violations []Violation
+	for _, validator := range e {
+		violations = append(violations, validator.Validate(rule)...)
+	}
+	return violations
+}
+
+// Check returns a ViolationError if given rule does not pass every validator
+func Check(validator Validator, rule *compute.Firewall) error {
+	if validator == nil {
+		return nil
+	}
+	if violations := validator.Validate(rule); len(violations) > 0 {
+		return &ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// ViolationError describe a rule refused by acceptance checks
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (v *ViolationError) Error() string {
+	return fmt.Sprintf("Rule violates %d acceptance check(s)", len(v.Violations))
+}
+
+// Config describe built-in checks to enable. Omitted settings disable the matching check
+type Config struct {
+	AdminPorts       []string `yaml:"admin_ports"`
+	MaxPortRange     int      `yaml:"max_port_range"`
+	AllowedProtocols []string `yaml:"allowed_protocols"`
+	RequireTarget    bool     `yaml:"require_target"`
+	Priority         *struct {
+		Min int64 `yaml:"min"`
+		Max int64 `yaml:"max"`
+	} `yaml:"priority"`
+}
+
+// LoadConfig reads a YAML or JSON policy configuration file
+func LoadConfig(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("Invalid policy configuration: %v", err)
+	}
+	return &config, nil
+}
+
+// Engine returns an engine running every configured check
+func (c *Config) Engine() (Engine, error) {
+	var engine Engine
+
+	if len(c.AdminPorts) > 0 {
+		var ports []portRange
+		for _, p := range c.AdminPorts {
+			r, err := parsePortRange(p)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid admin port: %v", err)
+			}
+			ports = append(ports, r)
+		}
+		engine = append(engine, &AdminPortsCheck{Ports: ports})
+	}
+	if c.MaxPortRange > 0 {
+		engine = append(engine, &PortRangeCheck{MaxWidth: c.MaxPortRange})
+	}
+	if len(c.AllowedProtocols) > 0 {
+		engine = append(engine, &ProtocolCheck{Protocols: c.AllowedProtocols})
+	}
+	if c.RequireTarget {
+		engine = append(engine, &TargetCheck{})
+	}
+	if c.Priority != nil {
+		if c.Priority.Min > c.Priority.Max {
+			return nil, fmt.Errorf("Invalid priority range: min %d is greater than max %d", c.Priority.Min, c.Priority.Max)
+		}
+		engine = append(engine, &PriorityCheck{Min: c.Priority.Min, Max: c.Priority.Max})
+	}
+
+	return engine, nil
+}
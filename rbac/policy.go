@@ -0,0 +1,147 @@
+package rbac
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Verb describe an action on firewall rules
+type Verb string
+
+// Supported verbs
+const (
+	VerbList   Verb = "list"
+	VerbGet    Verb = "get"
+	VerbCreate Verb = "create"
+	VerbUpdate Verb = "update"
+	VerbDelete Verb = "delete"
+)
+
+// Authorizer decides if a caller may act on an application
+type Authorizer interface {
+	Authorize(identity *auth.Identity, serviceProject, application string, verb Verb) error
+}
+
+// DeniedError is returned when a caller is not allowed to perform an action
+type DeniedError struct {
+	Caller         string
+	ServiceProject string
+	Application    string
+	Verb           Verb
+}
+
+func (d *DeniedError) Error() string {
+	return fmt.Sprintf("Caller '%s' is not allowed to %s rules of application '%s' in service project '%s'", d.Caller, d.Verb, d.Application, d.ServiceProject)
+}
+
+// Rule grants verbs on matching service projects and applications to identities or groups.
+// Service projects and applications accept shell patterns like `foo-*`.
+type Rule struct {
+	Identities      []string `yaml:"identities"`
+	Groups          []string `yaml:"groups"`
+	ServiceProjects []string `yaml:"service_projects"`
+	Applications    []string `yaml:"applications"`
+	Verbs           []Verb   `yaml:"verbs"`
+}
+
+// Policy is a set of rules. Implements Authorizer
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// LoadPolicy reads a YAML or JSON policy file
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy decodes a YAML or JSON policy
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("Invalid RBAC policy: %v", err)
+	}
+
+	for i, rule := range policy.Rules {
+		for _, pattern := range append(rule.ServiceProjects, rule.Applications...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("Invalid RBAC policy: rule %d has bad pattern '%s'", i, pattern)
+			}
+		}
+		for _, verb := range rule.Verbs {
+			switch verb {
+			case VerbList, VerbGet, VerbCreate, VerbUpdate, VerbDelete, "*":
+			default:
+				return nil, fmt.Errorf("Invalid RBAC policy: rule %d has unknown verb '%s'", i, verb)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// Authorize returns a DeniedError unless a rule grants verb on application to the caller
+func (p *Policy) Authorize(identity *auth.Identity, serviceProject, application string, verb Verb) error {
+	if identity != nil {
+		for _, rule := range p.Rules {
+			if rule.matchIdentity(identity) &&
+				matchAny(rule.ServiceProjects, serviceProject) &&
+				matchAny(rule.Applications, application) &&
+				rule.matchVerb(verb) {
+				return nil
+			}
+		}
+	}
+
+	caller := "anonymous"
+	if identity != nil {
+		caller = identity.String()
+	}
+	return &DeniedError{
+		Caller:         caller,
+		ServiceProject: serviceProject,
+		Application:    application,
+		Verb:           verb,
+	}
+}
+
+func (r *Rule) matchIdentity(identity *auth.Identity) bool {
+	for _, i := range r.Identities {
+		if i == "*" || (identity.Email != "" && i == identity.Email) || i == identity.Subject {
+			return true
+		}
+	}
+	for _, g := range r.Groups {
+		for _, group := range identity.Groups {
+			if g == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchVerb(verb Verb) bool {
+	for _, v := range r.Verbs {
+		if v == "*" || v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny returns true when value matches at least one pattern
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
+)
+
+type TestCase struct {
+	Title          string
+	Identity       *auth.Identity
+	ServiceProject string
+	Application    string
+	Verb           Verb
+	IsAllowed      bool
+}
+
+const testPolicy = `
+rules:
+  - identities: ["alice@example.com"]
+    service_projects: ["foo-sp"]
+    applications: ["*"]
+    verbs: ["*"]
+  - groups: ["k8s-readers"]
+    service_projects: ["kubernetes-*"]
+    applications: ["the-hard-way"]
+    verbs: ["list", "get"]
+`
+
+func TestAuthorize(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Unexpected error during policy parsing. Got %v\n", err)
+	}
+
+	alice := &auth.Identity{Subject: "1", Email: "alice@example.com"}
+	bob := &auth.Identity{Subject: "2", Email: "bob@example.com", Groups: []string{"k8s-readers"}}
+
+	suite := []TestCase{
+		TestCase{Title: "Identity allowed on any application", Identity: alice, ServiceProject: "foo-sp", Application: "web", Verb: VerbDelete, IsAllowed: true},
+		TestCase{Title: "Identity denied on another service project", Identity: alice, ServiceProject: "bar-sp", Application: "web", Verb: VerbList, IsAllowed: false},
+		TestCase{Title: "Group allowed to read", Identity: bob, ServiceProject: "kubernetes-demo", Application: "the-hard-way", Verb: VerbGet, IsAllowed: true},
+		TestCase{Title: "Group denied to write", Identity: bob, ServiceProject: "kubernetes-demo", Application: "the-hard-way", Verb: VerbCreate, IsAllowed: false},
+		TestCase{Title: "Group denied on another application", Identity: bob, ServiceProject: "kubernetes-demo", Application: "the-easy-way", Verb: VerbList, IsAllowed: false},
+		TestCase{Title: "Anonymous caller denied", Identity: nil, ServiceProject: "foo-sp", Application: "web", Verb: VerbList, IsAllowed: false},
+	}
+
+	for _, suiteCase := range suite {
+		t.Run(suiteCase.Title, func(t *testing.T) {
+			err := policy.Authorize(suiteCase.Identity, suiteCase.ServiceProject, suiteCase.Application, suiteCase.Verb)
+			if suiteCase.IsAllowed && err != nil {
+				t.Errorf("Expected caller to be allowed. Got %v", err)
+			}
+			if !suiteCase.IsAllowed {
+				if _, ok := err.(*DeniedError); !ok {
+					t.Errorf("Expected DeniedError. Got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	// JSON policies are accepted
+	_, err := ParsePolicy([]byte(`{"rules": [{"identities": ["alice@example.com"], "service_projects": ["foo-sp"], "applications": ["web"], "verbs": ["get"]}]}`))
+	if err != nil {
+		t.Errorf("Unexpected error with JSON policy. Got %v", err)
+	}
+
+	invalids := map[string]string{
+		"Unknown verb":  `{"rules": [{"identities": ["a"], "service_projects": ["*"], "applications": ["*"], "verbs": ["destroy"]}]}`,
+		"Bad pattern":   `{"rules": [{"identities": ["a"], "service_projects": ["[a-"], "applications": ["*"], "verbs": ["get"]}]}`,
+		"Unknown field": `{"rules": [{"users": ["a"]}]}`,
+	}
+	for title, data := range invalids {
+		t.Run(title, func(t *testing.T) {
+			if _, err := ParsePolicy([]byte(data)); err == nil {
+				t.Errorf("Expected error during policy parsing")
+			}
+		})
+	}
+}
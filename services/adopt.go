@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"google.golang.org/api/compute/v1"
+)
+
+// AdoptFirewallRules assigns existing rules to an application. Rules can't be renamed,
+// so each rule is recreated under the application naming scheme before the original rule is deleted.
+// Every rule is looked up and validated before the first creation, nothing is changed if a rule is invalid.
+func AdoptFirewallRules(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string, adoptions models.Adoptions) *models.ApplicationResult {
+	ctx, span := startSpan(ctx, "AdoptFirewallRules", project, serviceProject, application)
+	defer span.End()
+
+	result := models.ApplicationResult{
+		Project:        project,
+		ServiceProject: serviceProject,
+		Application:    application,
+		Results:        make([]models.RuleResult, len(adoptions)),
+	}
+
+	// Look up and validate every rule up front
+	prepared := make([]*compute.Firewall, len(adoptions))
+	names := make(map[string]bool)
+	invalid := false
+	for i, adoption := range adoptions {
+		customName := adoption.CustomName
+		if customName == "" {
+			customName = adoption.Name
+		}
+		result.Results[i].CustomName = customName
+		result.Results[i].AdoptedFrom = adoption.Name
+
+		err := helpers.ValidateName("custom_name", customName)
+		switch {
+		case adoption.Name == "":
+			err = fmt.Errorf("name is required")
+		case names[customName]:
+			err = fmt.Errorf("custom_name '%s' is duplicated", customName)
+		case err != nil:
+		default:
+			prepared[i], err = prepareAdoption(ctx, manager, project, serviceProject, application, customName, adoption.Name)
+		}
+		names[customName] = true
+
+		if err != nil {
+			invalid = true
+			result.Results[i].Status = models.RuleStatusInvalid
+			result.Results[i].Error = err.Error()
+			if value, ok := err.(*policy.ViolationError); ok {
+				result.Results[i].Violations = value.Violations
+			}
+			if value, ok := err.(*models.APIError); ok && value.Code == http.StatusConflict {
+				result.Results[i].Status = models.RuleStatusConflict
+			}
+		}
+	}
+
+	if invalid {
+		for i := range result.Results {
+			if result.Results[i].Status == "" {
+				result.Results[i].Status = models.RuleStatusSkipped
+				result.Results[i].Error = "Not processed because another rule is invalid"
+			}
+		}
+		return &result
+	}
+	defer trackRevision(ctx, manager, project, serviceProject, application)()
+
+	// Create each rule before deleting the original one, so that traffic is never blocked
+	for i, adoption := range adoptions {
+		customName := result.Results[i].CustomName
+		if prepared[i].Name == adoption.Name {
+			gRule := *prepared[i]
+			setResult(&result.Results[i], serviceProject, application, models.RuleStatusUnchanged, &gRule, nil)
+			continue
+		}
+
+		helpers.Logger(ctx).Debugf("Manager will create %s on %s to adopt %s\n", prepared[i].Name, project, adoption.Name)
+		gRule, err := createRule(ctx, manager, project, serviceProject, application, customName, prepared[i])
+		if err != nil {
+			setResult(&result.Results[i], serviceProject, application, models.RuleStatusCreated, nil, err)
+			continue
+		}
+
+		helpers.Logger(ctx).Debugf("Manager will delete %s on %s.\n", adoption.Name, project)
+		err = deleteRule(ctx, manager, project, serviceProject, application, customName, adoption.Name)
+		setResult(&result.Results[i], serviceProject, application, models.RuleStatusAdopted, gRule, nil)
+		if err != nil {
+			result.Results[i].Status = models.RuleStatusError
+			result.Results[i].Error = fmt.Sprintf("Created but unable to delete '%s': %v", adoption.Name, err)
+		}
+	}
+
+	return &result
+}
+
+// prepareAdoption returns the existing rule matching name as it will be recreated for the application.
+// Tags are kept so that the rule still applies to the same instances, unless the tag policy rejects them.
+// Rules owned by another application are refused with a conflict, as well as rules without ownership
+// whose name could be the legacy name of a rule of another application.
+func prepareAdoption(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application, customName, name string) (*compute.Firewall, error) {
+	gRule, err := manager.GetFirewallRule(ctx, project, name)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("Rule '%s' not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	owner, ok := ruleOwner(gRule)
+	if ok && (owner.ServiceProject != serviceProject || owner.Application != application) {
+		return nil, models.NewAPIError(http.StatusConflict, models.ReasonAlreadyExists, fmt.Sprintf("Rule '%s' is owned by application %s/%s", name, owner.ServiceProject, owner.Application))
+	}
+	if otherServiceProject, otherApplication, other := otherLegacyOwner(name, serviceProject, application); !ok && other {
+		return nil, models.NewAPIError(http.StatusConflict, models.ReasonAlreadyExists, fmt.Sprintf("Rule '%s' records no owner and may belong to application %s/%s", name, otherServiceProject, otherApplication))
+	}
+
+	rule := *gRule
+	clearOutputFields(&rule)
+	nameFirewallRule(serviceProject, application, customName, &rule)
+
+	if Tags.Mode == TagModeReject {
+		if err := Tags.apply(serviceProject, application, &rule); err != nil {
+			return nil, err
+		}
+	}
+	return &rule, policy.Check(Policy, &rule)
+}
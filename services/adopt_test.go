@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestAdoptFirewallRules(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project, serviceProject, application := "host", "foo-sp", "web"
+	legacy := func(name string) *compute.Firewall {
+		return &compute.Firewall{Name: name, Id: 42, Network: "global/networks/default", TargetTags: []string{"web"}, Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{Ports: []string{"443"}, IPProtocol: "tcp"}}}
+	}
+	manager.CreateFirewallRule(ctx, project, legacy("legacy-https"))
+	manager.CreateFirewallRule(ctx, project, legacy("legacy-ssh"))
+
+	// Nothing is changed when a rule is unknown
+	result := AdoptFirewallRules(ctx, manager, project, serviceProject, application, models.Adoptions{{Name: "legacy-https"}, {Name: "unknown"}})
+	assertStatuses(t, result, models.RuleStatusSkipped, models.RuleStatusInvalid)
+	if len(manager.Rules[project]) != 2 {
+		t.Errorf("Bad rules count. Got %d expected %d", len(manager.Rules[project]), 2)
+	}
+
+	// Nothing is changed on dry run
+	plan := NewPlanManager(manager)
+	result = AdoptFirewallRules(ctx, plan, project, serviceProject, application, models.Adoptions{{Name: "legacy-https", CustomName: "allow-https"}})
+	assertStatuses(t, result, models.RuleStatusAdopted)
+	if actions := plan.Actions(); len(actions) != 2 || actions[0].Action != PlanActionCreate || actions[1].Action != PlanActionDelete {
+		t.Errorf("Got actions %+v expected a creation then a deletion", actions)
+	}
+	if len(manager.Rules[project]) != 2 {
+		t.Errorf("Bad rules count. Got %d expected %d", len(manager.Rules[project]), 2)
+	}
+
+	// Rules are recreated under the application name, tags are kept
+	result = AdoptFirewallRules(ctx, manager, project, serviceProject, application, models.Adoptions{{Name: "legacy-https", CustomName: "allow-https"}, {Name: "legacy-ssh"}})
+	assertStatuses(t, result, models.RuleStatusAdopted, models.RuleStatusAdopted)
+	if result.Results[1].CustomName != "legacy-ssh" || result.Results[1].AdoptedFrom != "legacy-ssh" {
+		t.Errorf("Got result %+v expected legacy-ssh to be adopted under its own name", result.Results[1])
+	}
+	if _, err := manager.GetFirewallRule(ctx, project, "legacy-https"); !isNotFound(err) {
+		t.Errorf("Expected original rule to be deleted. Got %v", err)
+	}
+	gRule, err := manager.GetFirewallRule(ctx, project, "foo-sp-web-allow-https")
+	if err != nil {
+		t.Fatalf("Expected adopted rule to be created. Got %v", err)
+	}
+	if gRule.Id != 0 || len(gRule.TargetTags) != 1 || gRule.TargetTags[0] != "web" {
+		t.Errorf("Got rule %+v expected original tags without output only fields", gRule)
+	}
+
+	applicationRule, _ := ListFirewallRule(ctx, manager, project, serviceProject, application)
+	if len(applicationRule.Rules) != 2 {
+		t.Errorf("Bad application rules count. Got %d expected %d", len(applicationRule.Rules), 2)
+	}
+
+	// Adopted rules are left unchanged
+	result = AdoptFirewallRules(ctx, manager, project, serviceProject, application, models.Adoptions{{Name: "foo-sp-web-allow-https", CustomName: "allow-https"}})
+	assertStatuses(t, result, models.RuleStatusUnchanged)
+}
+
+func TestAdoptRuleOfAnotherApplication(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host"
+	CreateFirewallRules(ctx, manager, project, "bar-sp", "api", testRules("https"), false)
+	manager.CreateFirewallRule(ctx, project, &compute.Firewall{Name: "legacy-https"})
+
+	// Nothing is changed when a rule is owned by another application
+	result := AdoptFirewallRules(ctx, manager, project, "foo-sp", "web", models.Adoptions{{Name: "bar-sp-api-https"}, {Name: "legacy-https"}})
+	assertStatuses(t, result, models.RuleStatusConflict, models.RuleStatusSkipped)
+	applicationRule, _ := ListFirewallRule(ctx, manager, project, "bar-sp", "api")
+	assertCustomNames(t, applicationRule.Rules, "https")
+	if len(manager.Rules[project]) != 2 {
+		t.Errorf("Bad rules count. Got %d expected %d", len(manager.Rules[project]), 2)
+	}
+
+	// Rules without ownership named like a rule of another application are refused
+	manager.CreateFirewallRule(ctx, project, &compute.Firewall{Name: "team-a-app-allow-https"})
+	result = AdoptFirewallRules(ctx, manager, project, "team-b", "app", models.Adoptions{{Name: "team-a-app-allow-https", CustomName: "stolen"}})
+	assertStatuses(t, result, models.RuleStatusConflict)
+	if _, err := manager.GetFirewallRule(ctx, project, "team-a-app-allow-https"); err != nil {
+		t.Errorf("Expected rule of another application to be kept. Got %v", err)
+	}
+	if _, err := manager.GetFirewallRule(ctx, project, "team-b-app-stolen"); !isNotFound(err) {
+		t.Errorf("Expected no rule to be created. Got %v", err)
+	}
+
+	// Even under the legacy prefix of the application, which other applications may share
+	manager.CreateFirewallRule(ctx, project, &compute.Firewall{Name: "a-b-c-web"})
+	result = AdoptFirewallRules(ctx, manager, project, "a-b", "c", models.Adoptions{{Name: "a-b-c-web"}})
+	assertStatuses(t, result, models.RuleStatusConflict)
+
+	// Hashed names tell the owner of rules without ownership
+	defer func(naming NamingStrategy) { Naming = naming }(Naming)
+	Naming = HashedNaming{}
+	name := Naming.RuleName("bar-sp", "api", "ssh")
+	manager.CreateFirewallRule(ctx, project, &compute.Firewall{Name: name})
+	result = AdoptFirewallRules(ctx, manager, project, "foo-sp", "web", models.Adoptions{{Name: name}})
+	assertStatuses(t, result, models.RuleStatusConflict)
+
+	// Rules of the application itself can be adopted to follow the naming strategy
+	result = AdoptFirewallRules(ctx, manager, project, "bar-sp", "api", models.Adoptions{{Name: "bar-sp-api-https", CustomName: "https"}})
+	assertStatuses(t, result, models.RuleStatusAdopted)
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+)
+
+// ApplyFirewallRules reconciles rules of an application with the desired set of rules.
+// Missing rules are created, modified rules are updated and rules which are not desired anymore are deleted.
+// Nothing is changed if a desired rule is invalid.
+func ApplyFirewallRules(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string, rules models.FirewallRules) (*models.ApplicationResult, error) {
+	ctx, span := startSpan(ctx, "ApplyFirewallRules", project, serviceProject, application)
+	defer span.End()
+
+	result := models.ApplicationResult{
+		Project:        project,
+		ServiceProject: serviceProject,
+		Application:    application,
+		Results:        make([]models.RuleResult, len(rules)),
+	}
+
+	// Validate every rule up front
+	prepared, ok := prepareFirewallRules(serviceProject, application, rules, &result)
+	if !ok {
+		return &result, nil
+	}
+	defer trackRevision(ctx, manager, project, serviceProject, application)()
+
+	current, err := ListFirewallRule(ctx, manager, project, serviceProject, application)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]models.FirewallRule)
+	for _, rule := range current.Rules {
+		existing[rule.Rule.Name] = rule
+	}
+
+	// Create missing rules and update modified ones
+	for i := range prepared {
+		desired := &prepared[i]
+		rule, found := existing[desired.Name]
+		delete(existing, desired.Name)
+
+		if !found {
+			helpers.Logger(ctx).Debugf("Manager will create %s on %s\n", desired.Name, project)
+			gRule, err := createRule(ctx, manager, project, serviceProject, application, rules[i].CustomName, desired)
+			setResult(&result.Results[i], serviceProject, application, models.RuleStatusCreated, gRule, err)
+			continue
+		}
+
+		changes := diffFirewallRule(desired, &rule.Rule)
+		if len(changes) == 0 {
+			result.Results[i].Status = models.RuleStatusUnchanged
+			result.Results[i].Rule = &rule
+			continue
+		}
+
+		helpers.Logger(ctx).Debugf("Manager will update %s on %s, changed fields: %v\n", desired.Name, project, changes)
+		gRule, err := updateRule(ctx, manager, project, serviceProject, application, rules[i].CustomName, desired)
+		setResult(&result.Results[i], serviceProject, application, models.RuleStatusUpdated, gRule, err)
+		result.Results[i].Changes = changes
+	}
+
+	// Then delete rules which are not desired anymore
+	for _, rule := range current.Rules {
+		if _, ok := existing[rule.Rule.Name]; !ok {
+			continue
+		}
+
+		helpers.Logger(ctx).Debugf("Manager will delete %s on %s.\n", rule.Rule.Name, project)
+		deleted := models.RuleResult{CustomName: rule.CustomName}
+		setResult(&deleted, serviceProject, application, models.RuleStatusDeleted, nil, deleteRule(ctx, manager, project, serviceProject, application, rule.CustomName, rule.Rule.Name))
+		result.Results = append(result.Results, deleted)
+	}
+
+	return &result, nil
+}
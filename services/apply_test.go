@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestApplyFirewallRules(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host-project"
+	serviceProject := "foo-sp"
+	application := "web"
+
+	CreateFirewallRules(context.Background(), manager, project, serviceProject, application, testRules("keep", "change", "remove"), false)
+	CreateFirewallRules(context.Background(), manager, project, serviceProject, "db", testRules("other"), false)
+
+	// Google sets defaults and output only fields
+	for _, rule := range manager.Rules[project] {
+		rule.Network = "https://www.googleapis.com/compute/v1/projects/host-project/global/networks/default"
+		rule.Priority = 1000
+		rule.Direction = "INGRESS"
+		rule.SelfLink = "https://www.googleapis.com/compute/v1/projects/host-project/global/firewalls/" + rule.Name
+	}
+
+	desired := testRules("keep", "change", "add")
+	desired[1].Rule.Allowed[0].Ports = []string{"8443"}
+
+	result, err := ApplyFirewallRules(context.Background(), manager, project, serviceProject, application, desired)
+	if err != nil {
+		t.Fatalf("Unexpected error during apply. Got %v", err)
+	}
+	assertStatuses(t, result, models.RuleStatusUnchanged, models.RuleStatusUpdated, models.RuleStatusCreated, models.RuleStatusDeleted)
+	if result.Results[3].CustomName != "remove" {
+		t.Errorf("Bad deleted rule. Got %s expected %s", result.Results[3].CustomName, "remove")
+	}
+	if len(result.Results[1].Changes) != 1 || result.Results[1].Changes[0] != "allowed" {
+		t.Errorf("Bad changes. Got %v expected %v", result.Results[1].Changes, []string{"allowed"})
+	}
+
+	// Applying the same set again changes nothing
+	current, _ := ListFirewallRule(context.Background(), manager, project, serviceProject, application)
+	if len(current.Rules) != 3 {
+		t.Fatalf("Bad rules count. Got %d expected %d", len(current.Rules), 3)
+	}
+	result, err = ApplyFirewallRules(context.Background(), manager, project, serviceProject, application, testRules("keep", "add"))
+	if err != nil {
+		t.Fatalf("Unexpected error during apply. Got %v", err)
+	}
+	assertStatuses(t, result, models.RuleStatusUnchanged, models.RuleStatusUnchanged, models.RuleStatusDeleted)
+
+	// Other applications are not changed
+	if _, err := manager.GetFirewallRule(context.Background(), project, "foo-sp-db-other"); err != nil {
+		t.Errorf("Rule of another application should be kept. Got %v", err)
+	}
+}
+
+func TestDiffFirewallRule(t *testing.T) {
+	desired := compute.Firewall{
+		Network:    "global/networks/default",
+		Allowed:    []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "TCP", Ports: []string{"80", "443"}}},
+		TargetTags: []string{"b", "a"},
+	}
+	current := compute.Firewall{
+		Network:    "https://www.googleapis.com/compute/v1/projects/p/global/networks/default",
+		Allowed:    []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"443", "80"}}},
+		TargetTags: []string{"a", "b"},
+		Priority:   1000,
+		Direction:  "INGRESS",
+	}
+	if changes := diffFirewallRule(&desired, &current); len(changes) != 0 {
+		t.Errorf("Expected no change. Got %v", changes)
+	}
+
+	desired.SourceRanges = []string{"10.0.0.0/8"}
+	desired.Priority = 900
+	changes := diffFirewallRule(&desired, &current)
+	if len(changes) != 2 || changes[0] != "priority" || changes[1] != "sourceRanges" {
+		t.Errorf("Bad changes. Got %v expected %v", changes, []string{"priority", "sourceRanges"})
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/audit"
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"google.golang.org/api/compute/v1"
+)
+
+// Audit records every change made on rules. Nothing is recorded when nil
+var Audit audit.Sink
+
+// createRule creates rule through manager and records the change
+func createRule(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application, customName string, rule *compute.Firewall) (*compute.Firewall, error) {
+	gRule, err := manager.CreateFirewallRule(ctx, project, rule)
+	recordChange(ctx, manager, audit.ActionCreate, project, serviceProject, application, customName, nil, gRule, err)
+	return gRule, err
+}
+
+// updateRule replaces rule through manager and records the change
+func updateRule(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application, customName string, rule *compute.Firewall) (*compute.Firewall, error) {
+	before := auditedRule(ctx, manager, project, rule.Name)
+	gRule, err := manager.UpdateFirewallRule(ctx, project, rule)
+	recordChange(ctx, manager, audit.ActionUpdate, project, serviceProject, application, customName, before, gRule, err)
+	return gRule, err
+}
+
+// patchRule patches rule through manager and records the change
+func patchRule(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application, customName string, rule *compute.Firewall) (*compute.Firewall, error) {
+	before := auditedRule(ctx, manager, project, rule.Name)
+	gRule, err := manager.PatchFirewallRule(ctx, project, rule)
+	recordChange(ctx, manager, audit.ActionPatch, project, serviceProject, application, customName, before, gRule, err)
+	return gRule, err
+}
+
+// deleteRule deletes the rule matching name through manager and records the change
+func deleteRule(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application, customName, name string) error {
+	before := auditedRule(ctx, manager, project, name)
+	err := manager.DeleteFirewallRule(ctx, project, name)
+	recordChange(ctx, manager, audit.ActionDelete, project, serviceProject, application, customName, before, nil, err)
+	return err
+}
+
+// audited returns true when changes made through manager are recorded. Planned changes are not
+func audited(manager models.FirewallRuleManager) bool {
+	_, dryRun := manager.(*PlanManager)
+	return Audit != nil && !dryRun
+}
+
+// auditedRule returns the rule matching name as it is before a recorded change, nil otherwise
+func auditedRule(ctx context.Context, manager models.FirewallRuleManager, project, name string) *compute.Firewall {
+	if !audited(manager) {
+		return nil
+	}
+	rule, err := manager.GetFirewallRule(ctx, project, name)
+	if err != nil {
+		return nil
+	}
+	return rule
+}
+
+// recordChange writes an audit record of a change made through manager. Failing to record does not fail the change
+func recordChange(ctx context.Context, manager models.FirewallRuleManager, action, project, serviceProject, application, customName string, before, after *compute.Firewall, err error) {
+	if !audited(manager) {
+		return
+	}
+
+	record := audit.Record{
+		Time:           time.Now().UTC(),
+		RequestID:      helpers.RequestID(ctx),
+		Action:         action,
+		Project:        project,
+		ServiceProject: serviceProject,
+		Application:    application,
+		CustomName:     customName,
+		Before:         before,
+		After:          after,
+		Result:         audit.ResultSuccess,
+	}
+	if identity, ok := auth.FromContext(ctx); ok {
+		record.Caller = identity.String()
+	}
+	if err != nil {
+		record.Result = audit.ResultFailure
+		record.Error = err.Error()
+	}
+
+	if err := Audit.Write(&record); err != nil {
+		helpers.Logger(ctx).Errorf("Unable to write audit record of %s on %s: %v", action, customName, err)
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/audit"
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// memorySink keeps audit records in memory
+type memorySink struct {
+	mutex   sync.Mutex
+	records []*audit.Record
+}
+
+func (m *memorySink) Write(record *audit.Record) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.records = append(m.records, record)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	sink := &memorySink{}
+	Audit = sink
+	defer func() { Audit = nil }()
+
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project, serviceProject, application := "host", "foo-sp", "web"
+	ctx := helpers.WithRequestID(context.Background(), "1234")
+	ctx = auth.NewContext(ctx, &auth.Identity{Email: "alice@example.com"})
+	https := compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"443"}}}}
+	ssh := compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"22"}}}}
+
+	CreateFirewallRule(ctx, manager, project, serviceProject, application, "allow-admin", https)
+	UpdateFirewallRule(ctx, manager, project, serviceProject, application, "allow-admin", ssh)
+	DeleteFirewallRule(ctx, manager, project, serviceProject, application, "allow-admin")
+	DeleteFirewallRule(ctx, manager, project, serviceProject, application, "allow-admin")
+
+	// Planned changes are not recorded
+	CreateFirewallRule(ctx, NewPlanManager(manager), project, serviceProject, application, "allow-admin", https)
+
+	expected := []struct {
+		Action, Result        string
+		Before, After         bool
+		BeforePort, AfterPort string
+	}{
+		{audit.ActionCreate, audit.ResultSuccess, false, true, "", "443"},
+		{audit.ActionUpdate, audit.ResultSuccess, true, true, "443", "22"},
+		{audit.ActionDelete, audit.ResultSuccess, true, false, "22", ""},
+		{audit.ActionDelete, audit.ResultFailure, false, false, "", ""},
+	}
+	if len(sink.records) != len(expected) {
+		t.Fatalf("Got %d records expected %d", len(sink.records), len(expected))
+	}
+
+	for i, e := range expected {
+		record := sink.records[i]
+		if record.Action != e.Action || record.Result != e.Result {
+			t.Errorf("Record %d: got %s %s expected %s %s", i, record.Result, record.Action, e.Result, e.Action)
+		}
+		if (record.Before != nil) != e.Before || (record.After != nil) != e.After {
+			t.Errorf("Record %d: got before %v after %v", i, record.Before, record.After)
+		}
+		if record.Before != nil && record.Before.Allowed[0].Ports[0] != e.BeforePort {
+			t.Errorf("Record %d: got before port %s expected %s", i, record.Before.Allowed[0].Ports[0], e.BeforePort)
+		}
+		if record.After != nil && record.After.Allowed[0].Ports[0] != e.AfterPort {
+			t.Errorf("Record %d: got after port %s expected %s", i, record.After.Allowed[0].Ports[0], e.AfterPort)
+		}
+		if record.Caller != "alice@example.com" || record.RequestID != "1234" || record.CustomName != "allow-admin" {
+			t.Errorf("Record %d: got caller %s request %s custom name %s", i, record.Caller, record.RequestID, record.CustomName)
+		}
+	}
+	if sink.records[3].Error == "" {
+		t.Errorf("Failed change should record the error")
+	}
+}
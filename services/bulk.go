@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// CreateFirewallRules create a set of firewall rules for an application.
+// Every rule is validated before the first creation, nothing is created if a rule is invalid.
+// When rollback is set, rules already created are deleted as soon as a creation fails.
+func CreateFirewallRules(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string, rules models.FirewallRules, rollback bool) *models.ApplicationResult {
+	ctx, span := startSpan(ctx, "CreateFirewallRules", project, serviceProject, application)
+	defer span.End()
+
+	result := models.ApplicationResult{
+		Project:        project,
+		ServiceProject: serviceProject,
+		Application:    application,
+		Results:        make([]models.RuleResult, len(rules)),
+	}
+
+	// Validate every rule up front
+	prepared, ok := prepareFirewallRules(serviceProject, application, rules, &result)
+	if !ok {
+		return &result
+	}
+	defer trackRevision(ctx, manager, project, serviceProject, application)()
+
+	// Create rules
+	failed := false
+	for i := range prepared {
+		if failed && rollback {
+			result.Results[i].Status = models.RuleStatusSkipped
+			result.Results[i].Error = "Not created because another rule failed"
+			continue
+		}
+
+		helpers.Logger(ctx).Debugf("Manager will create %s on %s\n", prepared[i].Name, project)
+		gRule, err := createRule(ctx, manager, project, serviceProject, application, rules[i].CustomName, &prepared[i])
+		setResult(&result.Results[i], serviceProject, application, models.RuleStatusCreated, gRule, err)
+		failed = failed || err != nil
+	}
+
+	// Delete created rules when a rule failed
+	if failed && rollback {
+		for i := range result.Results {
+			if result.Results[i].Status != models.RuleStatusCreated {
+				continue
+			}
+
+			helpers.Logger(ctx).Debugf("Manager will roll back %s on %s\n", prepared[i].Name, project)
+			if err := deleteRule(ctx, manager, project, serviceProject, application, rules[i].CustomName, prepared[i].Name); err != nil {
+				result.Results[i].Error = fmt.Sprintf("Rollback failed: %v", err)
+				continue
+			}
+			result.Results[i].Status = models.RuleStatusRolledBack
+			result.Results[i].Rule = nil
+			result.Results[i].Error = "Rolled back because another rule failed"
+		}
+	}
+
+	return &result
+}
+
+// prepareFirewallRules validates a set of rules and returns rules as they will be sent to Google.
+// Invalid rules are reported in result and false is returned.
+func prepareFirewallRules(serviceProject, application string, rules models.FirewallRules, result *models.ApplicationResult) ([]compute.Firewall, bool) {
+	prepared := make([]compute.Firewall, len(rules))
+	names := make(map[string]bool)
+	invalid := false
+	for i, rule := range rules {
+		result.Results[i].CustomName = rule.CustomName
+		prepared[i] = rule.Rule
+
+		err := helpers.ValidateName("custom_name", rule.CustomName)
+		switch {
+		case rule.CustomName == "":
+			err = fmt.Errorf("custom_name is required")
+		case names[rule.CustomName]:
+			err = fmt.Errorf("custom_name '%s' is duplicated", rule.CustomName)
+		case err != nil:
+		default:
+			err = prepareFirewallRule(serviceProject, application, rule.CustomName, &prepared[i])
+		}
+		names[rule.CustomName] = true
+
+		if err != nil {
+			invalid = true
+			result.Results[i].Status = models.RuleStatusInvalid
+			result.Results[i].Error = err.Error()
+			if value, ok := err.(*policy.ViolationError); ok {
+				result.Results[i].Violations = value.Violations
+			}
+		}
+	}
+
+	if invalid {
+		for i := range result.Results {
+			if result.Results[i].Status == "" {
+				result.Results[i].Status = models.RuleStatusSkipped
+				result.Results[i].Error = "Not processed because another rule is invalid"
+			}
+		}
+		return nil, false
+	}
+	return prepared, true
+}
+
+// Parallelism is the maximum count of concurrent calls to the manager during operations on a set of rules
+var Parallelism = 5
+
+// DeleteFirewallRules delete every firewall rule of an application, with at most Parallelism concurrent deletions
+func DeleteFirewallRules(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string) (*models.ApplicationResult, error) {
+	ctx, span := startSpan(ctx, "DeleteFirewallRules", project, serviceProject, application)
+	defer span.End()
+
+	applicationRule, err := ListFirewallRule(ctx, manager, project, serviceProject, application)
+	if err != nil {
+		return nil, err
+	}
+	defer trackRevision(ctx, manager, project, serviceProject, application)()
+
+	result := models.ApplicationResult{
+		Project:        project,
+		ServiceProject: serviceProject,
+		Application:    application,
+		Results:        make([]models.RuleResult, len(applicationRule.Rules)),
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, Parallelism)
+	for i, rule := range applicationRule.Rules {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, rule models.FirewallRule) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			// Each goroutine owns its own result
+			result.Results[i].CustomName = rule.CustomName
+			helpers.Logger(ctx).Debugf("Manager will delete %s on %s.\n", rule.Rule.Name, project)
+			err := deleteRule(ctx, manager, project, serviceProject, application, rule.CustomName, rule.Rule.Name)
+			setResult(&result.Results[i], serviceProject, application, models.RuleStatusDeleted, nil, err)
+		}(i, rule)
+	}
+	wg.Wait()
+
+	return &result, nil
+}
+
+// setResult reports the outcome of a manager call on a single rule
+func setResult(result *models.RuleResult, serviceProject, application string, status models.RuleStatus, gRule *compute.Firewall, err error) {
+	if err != nil {
+		result.Status = models.RuleStatusError
+		if isConflict(err) {
+			result.Status = models.RuleStatusConflict
+		}
+		result.Error = err.Error()
+		return
+	}
+
+	result.Status = status
+	if gRule != nil {
+		rule := newFirewallRule(serviceProject, application, gRule)
+		result.Rule = &rule
+	}
+}
+
+// isConflict returns true when error reports an already existing resource
+func isConflict(err error) bool {
+	value, ok := err.(*googleapi.Error)
+	return ok && value.Code == http.StatusConflict
+}
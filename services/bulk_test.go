@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func testRules(names ...string) models.FirewallRules {
+	var rules models.FirewallRules
+	for _, name := range names {
+		rules = append(rules, models.FirewallRule{
+			CustomName: name,
+			Rule:       compute.Firewall{Network: "global/networks/default", Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{Ports: []string{"443"}, IPProtocol: "tcp"}}},
+		})
+	}
+	return rules
+}
+
+func statuses(result *models.ApplicationResult) []models.RuleStatus {
+	var s []models.RuleStatus
+	for _, r := range result.Results {
+		s = append(s, r.Status)
+	}
+	return s
+}
+
+func assertStatuses(t *testing.T, result *models.ApplicationResult, expected ...models.RuleStatus) {
+	got := statuses(result)
+	if len(got) != len(expected) {
+		t.Fatalf("Bad results count. Got %v expected %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Bad status for rule %d. Got %v expected %v", i, got, expected)
+			return
+		}
+	}
+}
+
+func TestCreateFirewallRules(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host-project"
+	serviceProject := "foo-sp"
+	application := "web"
+
+	// Every rule is created
+	result := CreateFirewallRules(context.Background(), manager, project, serviceProject, application, testRules("https", "admin"), false)
+	assertStatuses(t, result, models.RuleStatusCreated, models.RuleStatusCreated)
+	if result.Failed() {
+		t.Errorf("Expected successful result")
+	}
+	if len(manager.Rules[project]) != 2 {
+		t.Errorf("Bad rules count. Got %d expected %d", len(manager.Rules[project]), 2)
+	}
+
+	// Existing rule is reported as conflict without rollback
+	result = CreateFirewallRules(context.Background(), manager, project, serviceProject, application, testRules("metrics", "https"), false)
+	assertStatuses(t, result, models.RuleStatusCreated, models.RuleStatusConflict)
+	if !result.Failed() {
+		t.Errorf("Expected failed result")
+	}
+	if len(manager.Rules[project]) != 3 {
+		t.Errorf("Bad rules count. Got %d expected %d", len(manager.Rules[project]), 3)
+	}
+
+	// Created rules are deleted with rollback
+	result = CreateFirewallRules(context.Background(), manager, project, serviceProject, application, testRules("grpc", "https", "debug"), true)
+	assertStatuses(t, result, models.RuleStatusRolledBack, models.RuleStatusConflict, models.RuleStatusSkipped)
+	if len(manager.Rules[project]) != 3 {
+		t.Errorf("Bad rules count after rollback. Got %d expected %d", len(manager.Rules[project]), 3)
+	}
+}
+
+func TestCreateFirewallRulesValidation(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host-project"
+
+	Policy = policy.Engine{&policy.TargetCheck{}}
+	defer func() { Policy = nil }()
+
+	rules := testRules("https", "https", "")
+	rules = append(rules, models.FirewallRule{CustomName: "tagged", Rule: compute.Firewall{TargetTags: []string{"front"}}})
+
+	// Nothing is created when a rule is invalid
+	result := CreateFirewallRules(context.Background(), manager, project, "foo-sp", "web", rules, false)
+	assertStatuses(t, result, models.RuleStatusInvalid, models.RuleStatusInvalid, models.RuleStatusInvalid, models.RuleStatusSkipped)
+	if len(result.Results[0].Violations) != 1 {
+		t.Errorf("Expected violations to be reported. Got %v", result.Results[0].Violations)
+	}
+	if len(manager.Rules[project]) != 0 {
+		t.Errorf("No rule should be created. Got %d", len(manager.Rules[project]))
+	}
+}
+
+func TestDeleteFirewallRules(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host-project"
+
+	CreateFirewallRules(context.Background(), manager, project, "foo-sp", "web", testRules("a", "b", "c", "d", "e", "f", "g"), false)
+	CreateFirewallRules(context.Background(), manager, project, "foo-sp", "db", testRules("a"), false)
+
+	result, err := DeleteFirewallRules(context.Background(), manager, project, "foo-sp", "web")
+	if err != nil {
+		t.Fatalf("Unexpected error during delete. Got %v", err)
+	}
+	if len(result.Results) != 7 || result.Failed() {
+		t.Errorf("Expected 7 successful deletions. Got %v", statuses(result))
+	}
+
+	// Other applications are kept
+	if len(manager.Rules[project]) != 1 || manager.Rules[project][0].Name != "foo-sp-db-a" {
+		t.Errorf("Only rules of the application should be deleted. Got %d rules left", len(manager.Rules[project]))
+	}
+
+	// Unknown project is reported
+	if _, err := DeleteFirewallRules(context.Background(), manager, "non-existing-project", "foo-sp", "web"); err == nil {
+		t.Errorf("Expected error on non-existing project")
+	}
+}
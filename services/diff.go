@@ -0,0 +1,141 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// Default values set by Google when omitted
+const (
+	defaultPriority  = 1000
+	defaultDirection = "INGRESS"
+	defaultNetwork   = "global/networks/default"
+)
+
+// diffFirewallRule returns fields of desired rule which differ from current rule.
+// Output only fields and defaults set by Google are ignored.
+func diffFirewallRule(desired, current *compute.Firewall) []string {
+	d, c := normalizeFirewallRule(desired), normalizeFirewallRule(current)
+
+	fields := []struct {
+		name            string
+		desired, actual interface{}
+	}{
+		{"allowed", d.Allowed, c.Allowed},
+		{"denied", d.Denied, c.Denied},
+		{"description", d.Description, c.Description},
+		{"destinationRanges", d.DestinationRanges, c.DestinationRanges},
+		{"direction", d.Direction, c.Direction},
+		{"disabled", d.Disabled, c.Disabled},
+		{"logConfig", d.LogConfig, c.LogConfig},
+		{"network", d.Network, c.Network},
+		{"priority", d.Priority, c.Priority},
+		{"sourceRanges", d.SourceRanges, c.SourceRanges},
+		{"sourceServiceAccounts", d.SourceServiceAccounts, c.SourceServiceAccounts},
+		{"sourceTags", d.SourceTags, c.SourceTags},
+		{"targetServiceAccounts", d.TargetServiceAccounts, c.TargetServiceAccounts},
+		{"targetTags", d.TargetTags, c.TargetTags},
+	}
+
+	var changes []string
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.desired, field.actual) {
+			changes = append(changes, field.name)
+		}
+	}
+	return changes
+}
+
+// normalizedRule holds user settable fields of a rule in a comparable form
+type normalizedRule struct {
+	Allowed               []string
+	Denied                []string
+	Description           string
+	DestinationRanges     []string
+	Direction             string
+	Disabled              bool
+	LogConfig             bool
+	Network               string
+	Priority              int64
+	SourceRanges          []string
+	SourceServiceAccounts []string
+	SourceTags            []string
+	TargetServiceAccounts []string
+	TargetTags            []string
+}
+
+func normalizeFirewallRule(rule *compute.Firewall) normalizedRule {
+	n := normalizedRule{
+		Description:           rule.Description,
+		DestinationRanges:     sortedSet(rule.DestinationRanges),
+		Direction:             strings.ToUpper(rule.Direction),
+		Disabled:              rule.Disabled,
+		LogConfig:             rule.LogConfig != nil && rule.LogConfig.Enable,
+		Network:               rule.Network,
+		Priority:              rule.Priority,
+		SourceRanges:          sortedSet(rule.SourceRanges),
+		SourceServiceAccounts: sortedSet(rule.SourceServiceAccounts),
+		SourceTags:            sortedSet(rule.SourceTags),
+		TargetServiceAccounts: sortedSet(rule.TargetServiceAccounts),
+		TargetTags:            sortedSet(rule.TargetTags),
+	}
+
+	if n.Direction == "" {
+		n.Direction = defaultDirection
+	}
+	if n.Priority == 0 {
+		n.Priority = defaultPriority
+	}
+
+	// Google returns full network URL while users give relative ones
+	if n.Network == "" {
+		n.Network = defaultNetwork
+	}
+	if i := strings.Index(n.Network, "global/networks/"); i >= 0 {
+		n.Network = n.Network[i:]
+	}
+
+	for _, allowed := range rule.Allowed {
+		n.Allowed = append(n.Allowed, protocolPorts(allowed.IPProtocol, allowed.Ports)...)
+	}
+	for _, denied := range rule.Denied {
+		n.Denied = append(n.Denied, protocolPorts(denied.IPProtocol, denied.Ports)...)
+	}
+	n.Allowed = sortedSet(n.Allowed)
+	n.Denied = sortedSet(n.Denied)
+
+	return n
+}
+
+// protocolPorts returns `protocol:port` entries of an allowed or denied entry
+func protocolPorts(protocol string, ports []string) []string {
+	protocol = strings.ToLower(protocol)
+	if len(ports) == 0 {
+		return []string{protocol}
+	}
+	var entries []string
+	for _, port := range ports {
+		entries = append(entries, protocol+":"+port)
+	}
+	return entries
+}
+
+// sortedSet returns sorted unique values, nil when empty
+func sortedSet(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
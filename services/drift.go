@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/history"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/compute/v1"
+)
+
+// DetectDrift compares live rules of an application with its desired state, the last revision kept in History
+func DetectDrift(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string) (*models.DriftReport, error) {
+	ctx, span := startSpan(ctx, "DetectDrift", project, serviceProject, application)
+	defer span.End()
+
+	if History == nil {
+		return nil, errHistoryDisabled
+	}
+
+	key := history.Key{Project: project, ServiceProject: serviceProject, Application: application}
+	revision, err := lastRevision(key)
+	if err != nil {
+		return nil, err
+	}
+	if revision == nil {
+		return nil, models.NewAPIError(http.StatusNotFound, models.ReasonNotFound, fmt.Sprintf("No desired state recorded for application '%s'", application))
+	}
+
+	gRules, err := manager.ListFirewallRule(ctx, project, models.ListFilter{Name: models.NamePrefix(rulePrefix(serviceProject, application))})
+	if err != nil {
+		return nil, err
+	}
+	return compareRevision(key, revision, gRules), nil
+}
+
+// WatchDrift detects drift of every application having a revision, every interval until ctx is done.
+// Reports of drifted applications are given to notify, along with ctx.
+func WatchDrift(ctx context.Context, manager models.FirewallRuleManager, interval time.Duration, notify func(context.Context, *models.DriftReport)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		keys, err := History.Keys()
+		if err != nil {
+			helpers.Logger(ctx).Errorf("Unable to list applications to detect drift: %v", err)
+			continue
+		}
+
+		// List rules of each project once
+		projects := make(map[string][]history.Key)
+		for _, key := range keys {
+			projects[key.Project] = append(projects[key.Project], key)
+		}
+		for project, keys := range projects {
+			gRules, err := manager.ListFirewallRule(ctx, project, models.ListFilter{})
+			if err != nil {
+				helpers.Logger(ctx).Errorf("Unable to list rules of project %s to detect drift: %v", project, err)
+				continue
+			}
+			for _, key := range keys {
+				revision, err := lastRevision(key)
+				if err != nil || revision == nil {
+					continue
+				}
+				if report := compareRevision(key, revision, gRules); report.Drifted {
+					notify(ctx, report)
+				}
+			}
+		}
+	}
+}
+
+// LogDrift logs each drifted rule of a report with the logger of ctx
+func LogDrift(ctx context.Context, report *models.DriftReport) {
+	for _, drift := range report.Drifts {
+		helpers.Logger(ctx).WithFields(logrus.Fields{
+			"project":         report.Project,
+			"service_project": report.ServiceProject,
+			"application":     report.Application,
+			"custom_name":     drift.CustomName,
+			"drift":           drift.Status,
+			"changes":         drift.Changes,
+		}).Warnf("Rule %s of application %s is %s since revision %d", drift.CustomName, report.Application, drift.Status, report.Revision)
+	}
+}
+
+// lastRevision returns the last revision of an application, nil when it has none
+func lastRevision(key history.Key) (*history.Revision, error) {
+	revisions, err := History.List(key)
+	if err != nil || len(revisions) == 0 {
+		return nil, err
+	}
+	return &revisions[len(revisions)-1], nil
+}
+
+// compareRevision compares rules of an application found in a project with the rules of a revision
+func compareRevision(key history.Key, revision *history.Revision, gRules []*compute.Firewall) *models.DriftReport {
+	report := models.DriftReport{
+		Project:        key.Project,
+		ServiceProject: key.ServiceProject,
+		Application:    key.Application,
+		Revision:       revision.Revision,
+		Drifts:         []models.Drift{},
+	}
+
+	desired := make(map[string]*compute.Firewall)
+	for i := range revision.Rules {
+		desired[revision.Rules[i].Rule.Name] = &revision.Rules[i].Rule
+	}
+
+	for _, gRule := range gRules {
+		customName, owned := ownedCustomName(key.ServiceProject, key.Application, gRule)
+		if !owned {
+			continue
+		}
+
+		rule, ok := desired[gRule.Name]
+		delete(desired, gRule.Name)
+		if !ok {
+			report.Drifts = append(report.Drifts, models.Drift{CustomName: customName, Status: models.DriftUnexpected, Actual: gRule})
+			continue
+		}
+		if changes := diffFirewallRule(rule, gRule); len(changes) > 0 {
+			report.Drifts = append(report.Drifts, models.Drift{CustomName: customName, Status: models.DriftModified, Changes: changes, Desired: rule, Actual: gRule})
+		}
+	}
+
+	for _, rule := range desired {
+		customName, _ := ownedCustomName(key.ServiceProject, key.Application, rule)
+		report.Drifts = append(report.Drifts, models.Drift{CustomName: customName, Status: models.DriftMissing, Desired: rule})
+	}
+
+	sort.Slice(report.Drifts, func(i, j int) bool { return report.Drifts[i].CustomName < report.Drifts[j].CustomName })
+	report.Drifted = len(report.Drifts) > 0
+	return &report
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/history"
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/sirupsen/logrus"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestDetectDrift(t *testing.T) {
+	History = history.NewMemoryStore()
+	defer func() { History = nil }()
+
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project, serviceProject, application := "host", "foo-sp", "web"
+
+	// No desired state is recorded yet
+	if _, err := DetectDrift(ctx, manager, project, serviceProject, application); err == nil {
+		t.Errorf("Expected error without revision")
+	}
+
+	CreateFirewallRules(ctx, manager, project, serviceProject, application, testRules("allow-https", "allow-ssh", "allow-rdp"), false)
+
+	report, err := DetectDrift(ctx, manager, project, serviceProject, application)
+	if err != nil {
+		t.Fatalf("Unexpected error detecting drift. Got %v", err)
+	}
+	if report.Drifted {
+		t.Errorf("Got drifts %+v expected none right after a change", report.Drifts)
+	}
+
+	// Rules are changed by hand
+	manager.PatchFirewallRule(ctx, project, &compute.Firewall{Name: "foo-sp-web-allow-ssh", SourceRanges: []string{"0.0.0.0/0"}})
+	manager.DeleteFirewallRule(ctx, project, "foo-sp-web-allow-rdp")
+	allowAll := compute.Firewall{Name: "foo-sp-web-allow-all"}
+	models.SetOwnership(&allowAll, models.Ownership{ServiceProject: serviceProject, Application: application, CustomName: "allow-all"})
+	manager.CreateFirewallRule(ctx, project, &allowAll)
+	manager.CreateFirewallRule(ctx, project, &compute.Firewall{Name: "foo-sp-api-allow-all"})
+
+	report, err = DetectDrift(ctx, manager, project, serviceProject, application)
+	if err != nil {
+		t.Fatalf("Unexpected error detecting drift. Got %v", err)
+	}
+	expected := []models.Drift{
+		{CustomName: "allow-all", Status: models.DriftUnexpected},
+		{CustomName: "allow-rdp", Status: models.DriftMissing},
+		{CustomName: "allow-ssh", Status: models.DriftModified, Changes: []string{"sourceRanges"}},
+	}
+	if !report.Drifted || len(report.Drifts) != len(expected) {
+		t.Fatalf("Got drifts %+v expected %+v", report.Drifts, expected)
+	}
+	for i, drift := range report.Drifts {
+		if drift.CustomName != expected[i].CustomName || drift.Status != expected[i].Status || len(drift.Changes) != len(expected[i].Changes) {
+			t.Errorf("Got drift %+v expected %+v", drift, expected[i])
+		}
+	}
+
+	// Background job notifies drifted applications
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	reports := make(chan *models.DriftReport, 1)
+	go WatchDrift(watchCtx, manager, time.Millisecond, func(_ context.Context, report *models.DriftReport) {
+		select {
+		case reports <- report:
+		default:
+		}
+	})
+
+	select {
+	case report := <-reports:
+		if report.Application != application || len(report.Drifts) != len(expected) {
+			t.Errorf("Got report %+v expected drifts of %s", report, application)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected drift to be notified")
+	}
+}
+
+func TestLogDrift(t *testing.T) {
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	var buffer bytes.Buffer
+	logger.SetOutput(&buffer)
+	ctx := helpers.WithLogger(context.Background(), logger.WithField("job", "drift"))
+
+	LogDrift(ctx, &models.DriftReport{
+		Project:        "host",
+		ServiceProject: "foo-sp",
+		Application:    "web",
+		Revision:       2,
+		Drifts:         []models.Drift{{CustomName: "https", Status: models.DriftMissing}},
+	})
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("Unexpected error decoding entry %s. Got %v", buffer.String(), err)
+	}
+	if entry["job"] != "drift" || entry["custom_name"] != "https" || entry["level"] != "warning" {
+		t.Errorf("Got entry %v expected a warning logged with the logger of the context", entry)
+	}
+}
@@ -1,20 +1,33 @@
 package services
 
 import (
-	"fmt"
-	"strings"
+	"context"
 
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
 	"github.com/adeo/iwc-gcp-firewall-api/models"
-	"github.com/sirupsen/logrus"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/api/compute/v1"
 )
 
+// Policy contains acceptance checks run before a rule is created or updated. Every rule is accepted when nil
+var Policy policy.Validator
+
 // ListFirewallRule returns a set of firewall rules related to an application
-func ListFirewallRule(manager models.FirewallRuleManager, project, serviceProject, application string) (*models.ApplicationRule, error) {
-	logrus.Debugf("Manager will list rules for project %s\n", project)
+func ListFirewallRule(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string) (*models.ApplicationRule, error) {
+	ctx, span := startSpan(ctx, "ListFirewallRule", project, serviceProject, application)
+	defer span.End()
+
+	return listFirewallRule(ctx, manager, project, serviceProject, application, models.ListFilter{})
+}
 
-	// List all firewall rule in given project
-	gRules, err := manager.ListFirewallRule(project)
+// listFirewallRule returns firewall rules related to an application and selected by filter
+func listFirewallRule(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string, filter models.ListFilter) (*models.ApplicationRule, error) {
+	helpers.Logger(ctx).Debugf("Manager will list rules for project %s\n", project)
+
+	// List firewall rules of the application selected by filter in given project
+	filter.Name = models.NamePrefix(rulePrefix(serviceProject, application))
+	gRules, err := manager.ListFirewallRule(ctx, project, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -29,15 +42,10 @@ func ListFirewallRule(manager models.FirewallRuleManager, project, serviceProjec
 	var endUserResultRules models.FirewallRules
 
 	// For each obtains Google rules
-	prefix := fmt.Sprintf("%s-%s-", serviceProject, application)
 	for _, gRule := range gRules {
 		// Filter with managed rules with this application
-		if strings.HasPrefix(gRule.Name, prefix) {
-			customName := gRule.Name[len(prefix):]
-			endUserResultRules = append(endUserResultRules, models.FirewallRule{
-				Rule:       *gRule,
-				CustomName: customName,
-			})
+		if _, owned := ownedCustomName(serviceProject, application, gRule); owned {
+			endUserResultRules = append(endUserResultRules, newFirewallRule(serviceProject, application, gRule))
 		}
 	}
 
@@ -46,54 +54,166 @@ func ListFirewallRule(manager models.FirewallRuleManager, project, serviceProjec
 }
 
 // CreateFirewallRule create given firewall rule on given project
-func CreateFirewallRule(manager models.FirewallRuleManager, project string, serviceProject string, application string, ruleName string, rule compute.Firewall) (*models.ApplicationRule, error) {
-	rule.Name = fmt.Sprintf("%s-%s-%s", serviceProject, application, ruleName)
-	logrus.Debugf("Manager will create %s on %s\n", rule.Name, project)
-	gRule, err := manager.CreateFirewallRule(project, &rule)
-	if err != nil {
+func CreateFirewallRule(ctx context.Context, manager models.FirewallRuleManager, project string, serviceProject string, application string, ruleName string, rule compute.Firewall) (*models.ApplicationRule, error) {
+	ctx, span := startSpan(ctx, "CreateFirewallRule", project, serviceProject, application, attribute.String("custom_name", ruleName))
+	defer span.End()
+
+	if err := prepareFirewallRule(serviceProject, application, ruleName, &rule); err != nil {
 		return nil, err
 	}
 
-	prefix := fmt.Sprintf("%s-%s-", serviceProject, application)
-	createdRule := models.FirewallRule{
-		Rule:       *gRule,
-		CustomName: gRule.Name[len(prefix):],
+	defer trackRevision(ctx, manager, project, serviceProject, application)()
+	helpers.Logger(ctx).Debugf("Manager will create %s on %s\n", rule.Name, project)
+	gRule, err := createRule(ctx, manager, project, serviceProject, application, ruleName, &rule)
+	if err != nil {
+		return nil, err
 	}
 
-	return &models.ApplicationRule{
-		Application:    application,
-		Project:        project,
-		ServiceProject: serviceProject,
-		Rules:          models.FirewallRules{createdRule},
-	}, nil
+	return newApplicationRule(project, serviceProject, application, gRule), nil
 }
 
 // GetFirewallRule return matching firewall rule
-func GetFirewallRule(manager models.FirewallRuleManager, project string, serviceProject string, application string, ruleName string) (*models.ApplicationRule, error) {
-	logrus.Debugf("Searching rule mathing project '%s', service project '%s', application '%s' and name '%s'", project, serviceProject, application, ruleName)
-	n := fmt.Sprintf("%s-%s-%s", serviceProject, application, ruleName)
-	gRule, err := manager.GetFirewallRule(project, n)
+func GetFirewallRule(ctx context.Context, manager models.FirewallRuleManager, project string, serviceProject string, application string, ruleName string) (*models.ApplicationRule, error) {
+	ctx, span := startSpan(ctx, "GetFirewallRule", project, serviceProject, application, attribute.String("custom_name", ruleName))
+	defer span.End()
+
+	helpers.Logger(ctx).Debugf("Searching rule mathing project '%s', service project '%s', application '%s' and name '%s'", project, serviceProject, application, ruleName)
+	gRule, err := getOwnedRule(ctx, manager, project, serviceProject, application, ruleName)
 	if err != nil {
 		return nil, err
 	}
 
-	prefix := fmt.Sprintf("%s-%s-", serviceProject, application)
-	createdRule := models.FirewallRule{
+	return newApplicationRule(project, serviceProject, application, gRule), nil
+}
+
+// UpdateFirewallRule replace an existing firewall rule of an application with given rule
+func UpdateFirewallRule(ctx context.Context, manager models.FirewallRuleManager, project string, serviceProject string, application string, ruleName string, rule compute.Firewall) (*models.ApplicationRule, error) {
+	ctx, span := startSpan(ctx, "UpdateFirewallRule", project, serviceProject, application, attribute.String("custom_name", ruleName))
+	defer span.End()
+
+	// Force name to prevent rule to be moved out of the application
+	if err := prepareFirewallRule(serviceProject, application, ruleName, &rule); err != nil {
+		return nil, err
+	}
+	if _, err := getOwnedRule(ctx, manager, project, serviceProject, application, ruleName); err != nil {
+		return nil, err
+	}
+
+	defer trackRevision(ctx, manager, project, serviceProject, application)()
+	helpers.Logger(ctx).Debugf("Manager will update %s on %s\n", rule.Name, project)
+	gRule, err := updateRule(ctx, manager, project, serviceProject, application, ruleName, &rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return newApplicationRule(project, serviceProject, application, gRule), nil
+}
+
+// PatchFirewallRule update provided fields of an existing firewall rule of an application
+func PatchFirewallRule(ctx context.Context, manager models.FirewallRuleManager, project string, serviceProject string, application string, ruleName string, rule compute.Firewall) (*models.ApplicationRule, error) {
+	ctx, span := startSpan(ctx, "PatchFirewallRule", project, serviceProject, application, attribute.String("custom_name", ruleName))
+	defer span.End()
+
+	// Force name to prevent rule to be moved out of the application
+	// Ownership is kept when the description is patched
+	if rule.Description != "" {
+		nameFirewallRule(serviceProject, application, ruleName, &rule)
+	}
+	rule.Name = firewallRuleName(serviceProject, application, ruleName)
+	if err := Tags.apply(serviceProject, application, &rule); err != nil {
+		return nil, err
+	}
+
+	existing, err := getOwnedRule(ctx, manager, project, serviceProject, application, ruleName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Acceptance checks apply on the rule as it will be once patched
+	if Policy != nil {
+		patched, err := models.MergeFirewallRule(existing, &rule)
+		if err != nil {
+			return nil, err
+		}
+		if err := policy.Check(Policy, patched); err != nil {
+			return nil, err
+		}
+	}
+
+	defer trackRevision(ctx, manager, project, serviceProject, application)()
+	helpers.Logger(ctx).Debugf("Manager will patch %s on %s\n", rule.Name, project)
+	gRule, err := patchRule(ctx, manager, project, serviceProject, application, ruleName, &rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return newApplicationRule(project, serviceProject, application, gRule), nil
+}
+
+// DeleteFirewallRule delete firewall rule mathing project, service project, application name and rule name
+func DeleteFirewallRule(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application, customName string) error {
+	ctx, span := startSpan(ctx, "DeleteFirewallRule", project, serviceProject, application, attribute.String("custom_name", customName))
+	defer span.End()
+
+	ruleName := firewallRuleName(serviceProject, application, customName)
+	// Rules owned by another application are not deleted, failures are reported by the deletion
+	if gRule, err := manager.GetFirewallRule(ctx, project, ruleName); err == nil {
+		if _, owned := ownedCustomName(serviceProject, application, gRule); !owned {
+			return notFound(project, ruleName)
+		}
+	}
+	defer trackRevision(ctx, manager, project, serviceProject, application)()
+	helpers.Logger(ctx).Debugf("Manager will delete %s on %s.\n", ruleName, project)
+	return deleteRule(ctx, manager, project, serviceProject, application, customName, ruleName)
+}
+
+// getOwnedRule returns the rule of an application matching custom name. Rules owned by another application are not found
+func getOwnedRule(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application, customName string) (*compute.Firewall, error) {
+	name := firewallRuleName(serviceProject, application, customName)
+	gRule, err := manager.GetFirewallRule(ctx, project, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, owned := ownedCustomName(serviceProject, application, gRule); !owned {
+		return nil, notFound(project, name)
+	}
+	return gRule, nil
+}
+
+// prepareFirewallRule forces name, ownership and tags of a rule to belong to the application and runs acceptance checks
+func prepareFirewallRule(serviceProject, application, ruleName string, rule *compute.Firewall) error {
+	nameFirewallRule(serviceProject, application, ruleName, rule)
+	if err := Tags.apply(serviceProject, application, rule); err != nil {
+		return err
+	}
+	return policy.Check(Policy, rule)
+}
+
+// clearOutputFields clears fields of a rule which are set by Google, so that it can be sent again
+func clearOutputFields(rule *compute.Firewall) {
+	rule.Id = 0
+	rule.CreationTimestamp = ""
+	rule.Kind = ""
+	rule.SelfLink = ""
+}
+
+// newFirewallRule wrap a Google rule owned by an application into an end-user rule
+func newFirewallRule(serviceProject, application string, gRule *compute.Firewall) models.FirewallRule {
+	customName, _ := ownedCustomName(serviceProject, application, gRule)
+	return models.FirewallRule{
 		Rule:       *gRule,
-		CustomName: gRule.Name[len(prefix):],
+		CustomName: customName,
+		TargetTags: logicalTags(serviceProject, application, gRule.TargetTags),
+		SourceTags: logicalTags(serviceProject, application, gRule.SourceTags),
 	}
+}
 
+// newApplicationRule wrap a single Google rule into an end-user response
+func newApplicationRule(project, serviceProject, application string, gRule *compute.Firewall) *models.ApplicationRule {
 	return &models.ApplicationRule{
 		Application:    application,
 		Project:        project,
 		ServiceProject: serviceProject,
-		Rules:          models.FirewallRules{createdRule},
-	}, nil
-}
-
-// DeleteFirewallRule delete firewall rule mathing project, service project, application name and rule name
-func DeleteFirewallRule(manager models.FirewallRuleManager, project, serviceProject, application, customName string) error {
-	ruleName := fmt.Sprintf("%s-%s-%s", serviceProject, application, customName)
-	logrus.Debugf("Manager will delete %s on %s.\n", ruleName, project)
-	return manager.DeleteFirewallRule(project, ruleName)
+		Rules:          models.FirewallRules{newFirewallRule(serviceProject, application, gRule)},
+	}
 }
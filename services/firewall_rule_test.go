@@ -1,11 +1,14 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"testing"
 
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
 	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
 	"github.com/sirupsen/logrus"
 	compute "google.golang.org/api/compute/v1"
 )
@@ -14,59 +17,8 @@ func init() {
 	logrus.SetOutput(ioutil.Discard)
 }
 
-// FirewallRuleDummyClient provides primitives to collect rules from in-memory rules list
-type FirewallRuleDummyClient struct {
-	Rules map[string][]*compute.Firewall
-}
-
-func NewFirewallRuleDummyClient() (*FirewallRuleDummyClient, error) {
-	manager := FirewallRuleDummyClient{}
-	manager.Rules = make(map[string][]*compute.Firewall)
-	return &manager, nil
-}
-
-func (f *FirewallRuleDummyClient) ListFirewallRule(project string) ([]*compute.Firewall, error) {
-	if value, ok := f.Rules[project]; ok {
-		return value, nil
-	}
-	return nil, fmt.Errorf("Project not found")
-}
-
-func (f *FirewallRuleDummyClient) GetFirewallRule(project, name string) (*compute.Firewall, error) {
-	for _, rule := range f.Rules[project] {
-		if rule.Name == name {
-			return rule, nil
-		}
-	}
-	return nil, fmt.Errorf("Rule not found")
-}
-
-func (f *FirewallRuleDummyClient) CreateFirewallRule(project string, rule *compute.Firewall) (*compute.Firewall, error) {
-	for _, r := range f.Rules[project] {
-		if r.Name == rule.Name {
-			return nil, fmt.Errorf("Rule already exists")
-		}
-	}
-
-	f.Rules[project] = append(f.Rules[project], rule)
-	return rule, nil
-}
-
-func (f *FirewallRuleDummyClient) DeleteFirewallRule(project, name string) error {
-	rules := f.Rules[project]
-	for i, rule := range rules {
-		if rule.Name == name {
-			// Delete matching route
-			rules[i] = rules[len(rules)-1]
-			f.Rules[project] = rules[:len(rules)-1]
-			return nil
-		}
-	}
-	return fmt.Errorf("Rule not found")
-}
-
 func TestCreateFirewallRule(t *testing.T) {
-	manager, _ := NewFirewallRuleDummyClient()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
 	project := "dummy-project"
 	serviceProject := "dummy-service_project"
 	application := "dummy-application"
@@ -79,7 +31,7 @@ func TestCreateFirewallRule(t *testing.T) {
 
 	// Create dummy rule
 	for _, rule := range rules {
-		_, err := CreateFirewallRule(manager, project, serviceProject, application, rule.CustomName, rule.Rule)
+		_, err := CreateFirewallRule(context.Background(), manager, project, serviceProject, application, rule.CustomName, rule.Rule)
 		if err != nil {
 			t.Fatalf("Something wrong during rule creation. Got error %v\n", err)
 		}
@@ -93,7 +45,7 @@ func TestCreateFirewallRule(t *testing.T) {
 	}
 
 	// Inster existing rule should trigger error
-	_, err := CreateFirewallRule(manager, project, serviceProject, application, rule.CustomName, rule.Rule)
+	_, err := CreateFirewallRule(context.Background(), manager, project, serviceProject, application, rule.CustomName, rule.Rule)
 	if err == nil {
 		t.Errorf("Expected error during insert if rule already exists")
 	}
@@ -102,7 +54,7 @@ func TestCreateFirewallRule(t *testing.T) {
 
 func TestListFirewallRule(t *testing.T) {
 	// Add dummy content
-	manager, _ := NewFirewallRuleDummyClient()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
 
 	project := "kubernetes-host-project"
 	serviceProjects := []string{"kubernetes-demo", "kubernetes-training"}
@@ -113,18 +65,19 @@ func TestListFirewallRule(t *testing.T) {
 		for _, application := range applications {
 			name := fmt.Sprintf("%s-%s-%s", serviceProject, application, "allow-external")
 			rule := compute.Firewall{Name: name, Network: "global/networks/default", Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{Ports: []string{"22", "6443"}, IPProtocol: "TCP"}}}
+			models.SetOwnership(&rule, models.Ownership{ServiceProject: serviceProject, Application: application, CustomName: "allow-external"})
 			manager.Rules[project] = append(manager.Rules[project], &rule)
 		}
 	}
 
 	// Ask for non-existing project
-	_, err := ListFirewallRule(manager, "non-existing-project", serviceProjects[0], applications[0])
+	_, err := ListFirewallRule(context.Background(), manager, "non-existing-project", serviceProjects[0], applications[0])
 	if err == nil {
 		t.Fatalf("Expected error during ListApplicationFirewallRules on a non-existing project")
 	}
 
 	// Ask for one application in a random project
-	applicationRule, err := ListFirewallRule(manager, project, serviceProjects[0], applications[0])
+	applicationRule, err := ListFirewallRule(context.Background(), manager, project, serviceProjects[0], applications[0])
 	if err != nil {
 		t.Fatalf("Something wrong during ListApplicationFirewallRules. Got error : %v\n", err)
 	}
@@ -136,23 +89,24 @@ func TestListFirewallRule(t *testing.T) {
 
 func TestDeleteApplicationFirewallRules(t *testing.T) {
 	// Add dummy content
-	manager, _ := NewFirewallRuleDummyClient()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
 	project := "nginx-host-project"
 	serviceProject := "nginx-demo"
 	application := "front"
 	ruleCustomName := "allow-publicly"
 	name := fmt.Sprintf("%s-%s-%s", serviceProject, application, ruleCustomName)
 	gRule := compute.Firewall{Name: name, Network: "global/networks/default", Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{Ports: []string{"80", "443"}, IPProtocol: "TCP"}}}
+	models.SetOwnership(&gRule, models.Ownership{ServiceProject: serviceProject, Application: application, CustomName: ruleCustomName})
 	manager.Rules[project] = append(manager.Rules[project], &gRule)
 
 	// Ask to delete a rule
-	err := DeleteFirewallRule(manager, project, serviceProject, application, ruleCustomName)
+	err := DeleteFirewallRule(context.Background(), manager, project, serviceProject, application, ruleCustomName)
 	if err != nil {
 		t.Fatalf("Unexpected error during Delete. Got %v\n", err)
 	}
 
 	// Verify empty rules
-	apprules, err := ListFirewallRule(manager, project, serviceProject, application)
+	apprules, err := ListFirewallRule(context.Background(), manager, project, serviceProject, application)
 	if err != nil {
 		t.Fatalf("Unexpected error during Delete. Got %v\n", err)
 	}
@@ -162,8 +116,126 @@ func TestDeleteApplicationFirewallRules(t *testing.T) {
 	}
 
 	// Try to delete on non-existing project
-	err = DeleteFirewallRule(manager, project, serviceProject, application, ruleCustomName)
+	err = DeleteFirewallRule(context.Background(), manager, project, serviceProject, application, ruleCustomName)
 	if err == nil {
 		t.Fatalf("Expected error during Delete on non existing project. Got %v\n", err)
 	}
 }
+
+func TestUpdateFirewallRule(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "dummy-project"
+	serviceProject := "dummy-service_project"
+	application := "dummy-application"
+	customName := "allow-ssh"
+	name := fmt.Sprintf("%s-%s-%s", serviceProject, application, customName)
+	gRule := compute.Firewall{Name: name, Network: "global/networks/default", Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{Ports: []string{"22"}, IPProtocol: "TCP"}}}
+	models.SetOwnership(&gRule, models.Ownership{ServiceProject: serviceProject, Application: application, CustomName: customName})
+	manager.Rules[project] = append(manager.Rules[project], &gRule)
+
+	// Update port and try to rename the rule out of the application
+	update := compute.Firewall{Name: "another-application-rule", Network: "global/networks/default", Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{Ports: []string{"2222"}, IPProtocol: "TCP"}}}
+	applicationRule, err := UpdateFirewallRule(context.Background(), manager, project, serviceProject, application, customName, update)
+	if err != nil {
+		t.Fatalf("Unexpected error during Update. Got %v\n", err)
+	}
+
+	if manager.Rules[project][0].Name != name {
+		t.Errorf("Name don't match format. Got %s, expected %s\n", manager.Rules[project][0].Name, name)
+	}
+
+	if applicationRule.Rules[0].CustomName != customName {
+		t.Errorf("Bad custom name. Got %s, expected %s\n", applicationRule.Rules[0].CustomName, customName)
+	}
+
+	if port := manager.Rules[project][0].Allowed[0].Ports[0]; port != "2222" {
+		t.Errorf("Rule was not updated. Got port %s, expected %s\n", port, "2222")
+	}
+
+	// Update a non-existing rule should trigger error
+	_, err = UpdateFirewallRule(context.Background(), manager, project, serviceProject, application, "non-existing", update)
+	if err == nil {
+		t.Errorf("Expected error during update of a non-existing rule")
+	}
+}
+
+func TestPatchFirewallRule(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "dummy-project"
+	serviceProject := "dummy-service_project"
+	application := "dummy-application"
+	customName := "allow-web"
+	name := fmt.Sprintf("%s-%s-%s", serviceProject, application, customName)
+	gRule := compute.Firewall{Name: name, Network: "global/networks/default", TargetTags: []string{"web"}, Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{Ports: []string{"80"}, IPProtocol: "TCP"}}}
+	models.SetOwnership(&gRule, models.Ownership{ServiceProject: serviceProject, Application: application, CustomName: customName})
+	manager.Rules[project] = append(manager.Rules[project], &gRule)
+
+	// Patch only allowed ports
+	patch := compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{Ports: []string{"443"}, IPProtocol: "TCP"}}}
+	_, err := PatchFirewallRule(context.Background(), manager, project, serviceProject, application, customName, patch)
+	if err != nil {
+		t.Fatalf("Unexpected error during Patch. Got %v\n", err)
+	}
+
+	patched := manager.Rules[project][0]
+	if patched.Name != name {
+		t.Errorf("Name don't match format. Got %s, expected %s\n", patched.Name, name)
+	}
+
+	if patched.Allowed[0].Ports[0] != "443" {
+		t.Errorf("Rule was not patched. Got port %s, expected %s\n", patched.Allowed[0].Ports[0], "443")
+	}
+
+	if len(patched.TargetTags) != 1 || patched.TargetTags[0] != "web" {
+		t.Errorf("Patch should keep omitted fields. Got target tags %v\n", patched.TargetTags)
+	}
+}
+
+func TestFirewallRulePolicy(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "dummy-project"
+	serviceProject := "dummy-service-project"
+	application := "dummy-application"
+	ssh := []*compute.FirewallAllowed{&compute.FirewallAllowed{Ports: []string{"22"}, IPProtocol: "tcp"}}
+
+	Policy = policy.Engine{&policy.TargetCheck{}, &policy.PriorityCheck{Min: 1000, Max: 2000}}
+	defer func() { Policy = nil }()
+
+	// Every violation is reported and nothing is created
+	_, err := CreateFirewallRule(context.Background(), manager, project, serviceProject, application, "allow-ssh", compute.Firewall{Allowed: ssh, Priority: 1})
+	violationError, ok := err.(*policy.ViolationError)
+	if !ok {
+		t.Fatalf("Expected ViolationError. Got %v", err)
+	}
+	if len(violationError.Violations) != 2 {
+		t.Errorf("Bad violations count. Got %d expected %d", len(violationError.Violations), 2)
+	}
+	if len(manager.Rules[project]) != 0 {
+		t.Errorf("Refused rule should not be created")
+	}
+
+	// Valid rule is created
+	_, err = CreateFirewallRule(context.Background(), manager, project, serviceProject, application, "allow-ssh", compute.Firewall{Allowed: ssh, TargetTags: []string{"bastion"}})
+	if err != nil {
+		t.Fatalf("Unexpected error during rule creation. Got %v", err)
+	}
+
+	// Update path is checked
+	_, err = UpdateFirewallRule(context.Background(), manager, project, serviceProject, application, "allow-ssh", compute.Firewall{Allowed: ssh})
+	if _, ok := err.(*policy.ViolationError); !ok {
+		t.Errorf("Expected ViolationError on update. Got %v", err)
+	}
+
+	// Patch is checked once merged with existing rule
+	_, err = PatchFirewallRule(context.Background(), manager, project, serviceProject, application, "allow-ssh", compute.Firewall{Priority: 1500})
+	if err != nil {
+		t.Errorf("Unexpected error during patch keeping target tags. Got %v", err)
+	}
+	_, err = PatchFirewallRule(context.Background(), manager, project, serviceProject, application, "allow-ssh", compute.Firewall{Priority: 3000})
+	if _, ok := err.(*policy.ViolationError); !ok {
+		t.Errorf("Expected ViolationError on patch. Got %v", err)
+	}
+	if priority := manager.Rules[project][0].Priority; priority != 1500 {
+		t.Errorf("Refused patch should not be applied. Got priority %d expected %d", priority, 1500)
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/auth"
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/history"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+)
+
+// History keeps revisions of the rule set of applications. No revision is kept when nil
+var History history.Store
+
+var errHistoryDisabled = models.NewAPIError(http.StatusNotFound, models.ReasonNotFound, "History is not enabled")
+
+// applicationLock serializes tracked changes of an application. Users counts changes holding or waiting for it
+type applicationLock struct {
+	sync.Mutex
+	users int
+}
+
+var (
+	locksMutex sync.Mutex
+	locks      = make(map[history.Key]*applicationLock)
+)
+
+// lockApplication waits until no other tracked change of the application runs and returns the function releasing it
+func lockApplication(key history.Key) func() {
+	locksMutex.Lock()
+	lock, ok := locks[key]
+	if !ok {
+		lock = &applicationLock{}
+		locks[key] = lock
+	}
+	lock.users++
+	locksMutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		locksMutex.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(locks, key)
+		}
+		locksMutex.Unlock()
+	}
+}
+
+// ListRevisions returns past revisions of the rule set of an application
+func ListRevisions(project, serviceProject, application string) (*history.ApplicationHistory, error) {
+	if History == nil {
+		return nil, errHistoryDisabled
+	}
+
+	revisions, err := History.List(history.Key{Project: project, ServiceProject: serviceProject, Application: application})
+	if err != nil {
+		return nil, err
+	}
+	return &history.ApplicationHistory{
+		Project:        project,
+		ServiceProject: serviceProject,
+		Application:    application,
+		Revisions:      revisions,
+	}, nil
+}
+
+// RollbackFirewallRules restores rules of an application as they were at given revision.
+// Rules are created, updated and deleted as a desired set of rules would be applied.
+func RollbackFirewallRules(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string, revision int) (*models.ApplicationResult, error) {
+	ctx, span := startSpan(ctx, "RollbackFirewallRules", project, serviceProject, application)
+	defer span.End()
+
+	if History == nil {
+		return nil, errHistoryDisabled
+	}
+
+	r, err := History.Get(history.Key{Project: project, ServiceProject: serviceProject, Application: application}, revision)
+	if err == history.ErrNotFound {
+		return nil, models.NewAPIError(http.StatusNotFound, models.ReasonNotFound, fmt.Sprintf("Revision %d of application '%s' not found", revision, application))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(models.FirewallRules, len(r.Rules))
+	for i, rule := range r.Rules {
+		rules[i] = models.FirewallRule{CustomName: rule.CustomName, Rule: rule.Rule}
+		clearOutputFields(&rules[i].Rule)
+	}
+
+	helpers.Logger(ctx).Debugf("Rolling back application %s of %s to revision %d\n", application, project, revision)
+	return ApplyFirewallRules(ctx, manager, project, serviceProject, application, rules)
+}
+
+// trackRevision records the current rules of an application when it has no revision yet,
+// so that the state before its first change can be restored. It returns a function recording
+// rules as a new revision, to be called once the change is done. Planned changes are not tracked.
+// Tracked changes of an application are serialized until the returned function is called, so that
+// each revision holds the rules as left by a single change, at least within this instance.
+func trackRevision(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string) func() {
+	if _, dryRun := manager.(*PlanManager); History == nil || dryRun {
+		return func() {}
+	}
+
+	key := history.Key{Project: project, ServiceProject: serviceProject, Application: application}
+	unlock := lockApplication(key)
+	if revisions, err := History.List(key); err == nil && len(revisions) == 0 {
+		recordRevision(ctx, manager, key, false)
+	}
+	return func() {
+		defer unlock()
+		recordRevision(ctx, manager, key, true)
+	}
+}
+
+// recordRevision stores current rules of an application as a new revision, unless they did not change.
+// The revision is attributed to the caller of the request when attributed is set.
+func recordRevision(ctx context.Context, manager models.FirewallRuleManager, key history.Key, attributed bool) {
+	current, err := ListFirewallRule(ctx, manager, key.Project, key.ServiceProject, key.Application)
+	if err != nil {
+		helpers.Logger(ctx).Errorf("Unable to record revision of application %s: %v", key.Application, err)
+		return
+	}
+	rules := current.Rules
+	sort.Slice(rules, func(i, j int) bool { return rules[i].CustomName < rules[j].CustomName })
+
+	revisions, err := History.List(key)
+	if err != nil {
+		helpers.Logger(ctx).Errorf("Unable to record revision of application %s: %v", key.Application, err)
+		return
+	}
+	if len(revisions) > 0 && sameRules(revisions[len(revisions)-1].Rules, rules) {
+		return
+	}
+
+	revision := history.Revision{
+		Time:  time.Now().UTC(),
+		Rules: rules,
+	}
+	if attributed {
+		revision.RequestID = helpers.RequestID(ctx)
+		if identity, ok := auth.FromContext(ctx); ok {
+			revision.Caller = identity.String()
+		}
+	}
+	if _, err := History.Append(key, revision); err != nil {
+		helpers.Logger(ctx).Errorf("Unable to record revision of application %s: %v", key.Application, err)
+	}
+}
+
+// sameRules returns true when both sets of rules have the same JSON representation
+func sameRules(a, b models.FirewallRules) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
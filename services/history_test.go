@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/history"
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestRollbackFirewallRules(t *testing.T) {
+	History = history.NewMemoryStore()
+	defer func() { History = nil }()
+
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project, serviceProject, application := "host", "foo-sp", "web"
+	ssh := compute.Firewall{Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"22"}}}}
+
+	// An existing rule is kept as the first revision
+	https := compute.Firewall{Name: "foo-sp-web-allow-https", Allowed: []*compute.FirewallAllowed{&compute.FirewallAllowed{IPProtocol: "tcp", Ports: []string{"443"}}}}
+	models.SetOwnership(&https, models.Ownership{ServiceProject: serviceProject, Application: application, CustomName: "allow-https"})
+	manager.Rules[project] = append(manager.Rules[project], &https)
+	CreateFirewallRule(ctx, manager, project, serviceProject, application, "allow-ssh", ssh)
+	PatchFirewallRule(ctx, manager, project, serviceProject, application, "allow-https", compute.Firewall{Priority: 500})
+
+	// Planned and unchanged rule sets are not new revisions
+	CreateFirewallRule(ctx, NewPlanManager(manager), project, serviceProject, application, "allow-rdp", ssh)
+	PatchFirewallRule(ctx, manager, project, serviceProject, application, "allow-https", compute.Firewall{Priority: 500})
+
+	applicationHistory, err := ListRevisions(project, serviceProject, application)
+	if err != nil {
+		t.Fatalf("Unexpected error listing revisions. Got %v", err)
+	}
+	revisions := applicationHistory.Revisions
+	if len(revisions) != 3 {
+		t.Fatalf("Got %d revisions expected %d", len(revisions), 3)
+	}
+	if len(revisions[0].Rules) != 1 || len(revisions[1].Rules) != 2 || revisions[2].Rules[0].Rule.Priority != 500 {
+		t.Errorf("Got revisions %+v", revisions)
+	}
+
+	// Dry run plans changes without applying them
+	plan := NewPlanManager(manager)
+	_, err = RollbackFirewallRules(ctx, plan, project, serviceProject, application, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error during planned rollback. Got %v", err)
+	}
+	if len(plan.Actions()) != 2 || len(manager.Rules[project]) != 2 {
+		t.Errorf("Got actions %+v expected an update and a deletion only planned", plan.Actions())
+	}
+
+	// Rollback restores the first revision
+	result, err := RollbackFirewallRules(ctx, manager, project, serviceProject, application, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error during rollback. Got %v", err)
+	}
+	assertStatuses(t, result, models.RuleStatusUpdated, models.RuleStatusDeleted)
+	if len(manager.Rules[project]) != 1 || manager.Rules[project][0].Priority != 0 {
+		t.Errorf("Got rules %+v expected first revision to be restored", manager.Rules[project])
+	}
+
+	// Rollback is a new revision
+	applicationHistory, _ = ListRevisions(project, serviceProject, application)
+	if len(applicationHistory.Revisions) != 4 {
+		t.Errorf("Got %d revisions expected %d", len(applicationHistory.Revisions), 4)
+	}
+
+	if _, err := RollbackFirewallRules(ctx, manager, project, serviceProject, application, 42); err == nil {
+		t.Errorf("Expected error on unknown revision")
+	}
+}
+
+// slowManager delays creations so that concurrent changes interleave
+type slowManager struct {
+	models.FirewallRuleManager
+}
+
+func (m slowManager) CreateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	defer time.Sleep(time.Millisecond)
+	time.Sleep(time.Millisecond)
+	return m.FirewallRuleManager.CreateFirewallRule(ctx, project, rule)
+}
+
+func TestConcurrentRevisions(t *testing.T) {
+	History = history.NewMemoryStore()
+	defer func() { History = nil }()
+
+	dummy, _ := managertest.NewFirewallRuleDummyClient()
+	manager := slowManager{dummy}
+	project, serviceProject, application := "host", "foo-sp", "web"
+	dummy.Rules[project] = []*compute.Firewall{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := helpers.WithRequestID(context.Background(), strconv.Itoa(i))
+			CreateFirewallRule(ctx, manager, project, serviceProject, application, fmt.Sprintf("allow-%d", i), compute.Firewall{})
+		}(i)
+	}
+	wg.Wait()
+
+	// Each change is a revision adding the rule created by its request
+	applicationHistory, _ := ListRevisions(project, serviceProject, application)
+	revisions := applicationHistory.Revisions
+	if len(revisions) != 11 {
+		t.Fatalf("Got %d revisions expected %d", len(revisions), 11)
+	}
+	for i, revision := range revisions[1:] {
+		if len(revision.Rules) != i+1 {
+			t.Errorf("Got %d rules in revision %d expected %d", len(revision.Rules), revision.Revision, i+1)
+		}
+		found := false
+		for _, rule := range revision.Rules {
+			found = found || rule.CustomName == "allow-"+revision.RequestID
+		}
+		if !found {
+			t.Errorf("Expected revision %d to hold the rule created by request %s", revision.Revision, revision.RequestID)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/history"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/compute/v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LoadApplications reads a YAML or JSON file listing applications by project, service project and application
+func LoadApplications(filename string) ([]history.Key, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []struct {
+		Project        string `yaml:"project"`
+		ServiceProject string `yaml:"service_project"`
+		Application    string `yaml:"application"`
+	}
+	if err := yaml.UnmarshalStrict(data, &entries); err != nil {
+		return nil, fmt.Errorf("Invalid applications file: %v", err)
+	}
+
+	applications := make([]history.Key, len(entries))
+	for i, entry := range entries {
+		if entry.Project == "" || entry.ServiceProject == "" || entry.Application == "" {
+			return nil, fmt.Errorf("Invalid applications file: entry %d must set project, service_project and application", i)
+		}
+		applications[i] = history.Key{Project: entry.Project, ServiceProject: entry.ServiceProject, Application: entry.Application}
+	}
+	return applications, nil
+}
+
+// MigrateOwnership records ownership in the description of rules created before it was recorded.
+// Rules without ownership are given to the application whose legacy prefix starts their name.
+// Rules matching the prefix of several applications are ambiguous, they are reported and left unchanged
+func MigrateOwnership(ctx context.Context, manager models.FirewallRuleManager, applications []history.Key) error {
+	projects := make(map[string][]history.Key)
+	for _, key := range applications {
+		projects[key.Project] = append(projects[key.Project], key)
+	}
+
+	failed := 0
+	for project, keys := range projects {
+		gRules, err := manager.ListFirewallRule(ctx, project, models.ListFilter{})
+		if err != nil {
+			return fmt.Errorf("Unable to list rules of project %s: %v", project, err)
+		}
+
+		for _, gRule := range gRules {
+			if _, ok := models.RuleOwnership(gRule); ok {
+				continue
+			}
+			owners := legacyOwners(gRule.Name, keys)
+			if len(owners) == 0 {
+				continue
+			}
+
+			logger := helpers.Logger(ctx).WithFields(logrus.Fields{"project": project, "rule": gRule.Name})
+			if len(owners) > 1 {
+				var names []string
+				for _, owner := range owners {
+					names = append(names, owner.ServiceProject+"/"+owner.Application)
+				}
+				logger.Warnf("Rule %s may belong to applications %s, its ownership is left unrecorded", gRule.Name, strings.Join(names, ", "))
+				continue
+			}
+
+			owner := owners[0]
+			customName := strings.TrimPrefix(gRule.Name, LegacyNaming{}.Prefix(owner.ServiceProject, owner.Application))
+			patch := compute.Firewall{Name: gRule.Name, Description: gRule.Description}
+			models.SetOwnership(&patch, models.Ownership{ServiceProject: owner.ServiceProject, Application: owner.Application, CustomName: customName})
+			if _, err := patchRule(ctx, manager, project, owner.ServiceProject, owner.Application, customName, &patch); err != nil {
+				failed++
+				logger.Errorf("Unable to record ownership of rule %s: %v", gRule.Name, err)
+				continue
+			}
+			logger.Infof("Rule %s is owned by application %s/%s", gRule.Name, owner.ServiceProject, owner.Application)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Unable to record ownership of %d rule(s)", failed)
+	}
+	return nil
+}
+
+// legacyOwners returns the applications whose legacy prefix starts name
+func legacyOwners(name string, applications []history.Key) []history.Key {
+	var owners []history.Key
+	for _, key := range applications {
+		prefix := LegacyNaming{}.Prefix(key.ServiceProject, key.Application)
+		if len(name) > len(prefix) && strings.HasPrefix(name, prefix) {
+			owners = append(owners, key)
+		}
+	}
+	return owners
+}
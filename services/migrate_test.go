@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/history"
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestMigrateOwnership(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host"
+	for _, name := range []string{"foo-sp-web-https", "a-b-c-web", "bar-sp-api-ssh", "legacy-https"} {
+		manager.CreateFirewallRule(ctx, project, &compute.Firewall{Name: name, Description: "Created by hand"})
+	}
+	applications := []history.Key{
+		{Project: project, ServiceProject: "foo-sp", Application: "web"},
+		{Project: project, ServiceProject: "a", Application: "b-c"},
+		{Project: project, ServiceProject: "a-b", Application: "c"},
+	}
+
+	// Rules created before ownership was recorded belong to no application
+	applicationRule, _ := ListFirewallRule(ctx, manager, project, "foo-sp", "web")
+	assertCustomNames(t, applicationRule.Rules)
+
+	if err := MigrateOwnership(ctx, manager, applications); err != nil {
+		t.Fatalf("Unexpected error migrating ownership. Got %v", err)
+	}
+	applicationRule, _ = ListFirewallRule(ctx, manager, project, "foo-sp", "web")
+	assertCustomNames(t, applicationRule.Rules, "https")
+	if description := applicationRule.Rules[0].Rule.Description; !strings.HasPrefix(description, "Created by hand\n") {
+		t.Errorf("Got description %s expected the original description to be kept", description)
+	}
+
+	// Ambiguous and unknown rules are left unchanged
+	for _, name := range []string{"a-b-c-web", "bar-sp-api-ssh", "legacy-https"} {
+		gRule, _ := manager.GetFirewallRule(ctx, project, name)
+		if _, ok := models.RuleOwnership(gRule); ok {
+			t.Errorf("Expected ownership of %s to be left unrecorded", name)
+		}
+	}
+
+	// Migration can run again
+	if err := MigrateOwnership(ctx, manager, applications); err != nil {
+		t.Errorf("Unexpected error migrating ownership again. Got %v", err)
+	}
+}
+
+func TestLoadApplications(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "applications.yaml")
+	ioutil.WriteFile(filename, []byte("- project: host\n  service_project: foo-sp\n  application: web\n"), 0600)
+	applications, err := LoadApplications(filename)
+	if err != nil || len(applications) != 1 || applications[0] != (history.Key{Project: "host", ServiceProject: "foo-sp", Application: "web"}) {
+		t.Errorf("Got applications %+v and error %v expected foo-sp/web in host", applications, err)
+	}
+
+	ioutil.WriteFile(filename, []byte("- project: host\n  service_project: foo-sp\n"), 0600)
+	if _, err := LoadApplications(filename); err == nil {
+		t.Errorf("Expected error without application")
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"google.golang.org/api/compute/v1"
+)
+
+// NamingStrategy builds names of the rules owned by an application
+type NamingStrategy interface {
+	// Prefix returns the prefix of the name of every rule of an application
+	Prefix(serviceProject, application string) string
+	// RuleName returns the name of the rule of an application matching custom name
+	RuleName(serviceProject, application, customName string) string
+	// Owner returns the application a rule name was built for, ok is false when the name doesn't tell
+	Owner(name string) (serviceProject, application string, ok bool)
+}
+
+// Supported naming strategies
+const (
+	NamingLegacy = "legacy"
+	NamingHashed = "hashed"
+)
+
+// LegacyNaming names rules serviceProject-application-customName. Prefixes of distinct applications
+// may collide, ownership stored in rule descriptions tells them apart. Implements NamingStrategy
+type LegacyNaming struct{}
+
+// Prefix returns serviceProject-application-
+func (LegacyNaming) Prefix(serviceProject, application string) string {
+	return fmt.Sprintf("%s-%s-", serviceProject, application)
+}
+
+// RuleName returns serviceProject-application-customName
+func (l LegacyNaming) RuleName(serviceProject, application, customName string) string {
+	return l.Prefix(serviceProject, application) + customName
+}
+
+// Owner never tells the application from a name, as prefixes are ambiguous
+func (LegacyNaming) Owner(name string) (string, string, bool) {
+	return "", "", false
+}
+
+// HashedNaming names rules serviceProject-application-hash-customName, hash being computed from
+// service project and application so that prefixes of distinct applications never collide. Implements NamingStrategy
+type HashedNaming struct{}
+
+// Prefix returns serviceProject-application-hash-
+func (HashedNaming) Prefix(serviceProject, application string) string {
+	sum := sha256.Sum256([]byte(serviceProject + "/" + application))
+	return fmt.Sprintf("%s-%s-%s-", serviceProject, application, hex.EncodeToString(sum[:])[:8])
+}
+
+// RuleName returns serviceProject-application-hash-customName
+func (h HashedNaming) RuleName(serviceProject, application, customName string) string {
+	return h.Prefix(serviceProject, application) + customName
+}
+
+// Owner returns the service project and application whose prefix, hash included, starts name
+func (h HashedNaming) Owner(name string) (string, string, bool) {
+	parts := strings.Split(name, "-")
+	for i := 1; i < len(parts); i++ {
+		for j := i + 1; j < len(parts)-1; j++ {
+			serviceProject, application := strings.Join(parts[:i], "-"), strings.Join(parts[i:j], "-")
+			if strings.HasPrefix(name, h.Prefix(serviceProject, application)) {
+				return serviceProject, application, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// ParseNaming returns the NamingStrategy matching given name
+func ParseNaming(name string) (NamingStrategy, error) {
+	switch strings.ToLower(name) {
+	case NamingLegacy:
+		return LegacyNaming{}, nil
+	case NamingHashed:
+		return HashedNaming{}, nil
+	}
+	return nil, fmt.Errorf("Unknown naming strategy '%s', expected '%s' or '%s'", name, NamingLegacy, NamingHashed)
+}
+
+// Naming is the strategy used to name rules
+var Naming NamingStrategy = LegacyNaming{}
+
+// ownedCustomName returns the custom name of a rule and whether the rule is owned by the application.
+// Ownership stored in the rule description prevails. Rules without ownership are only matched on names telling
+// their owner, legacy prefixes being shared by distinct applications. MigrateOwnership records their ownership
+func ownedCustomName(serviceProject, application string, gRule *compute.Firewall) (string, bool) {
+	if ownership, ok := models.RuleOwnership(gRule); ok {
+		return ownership.CustomName, ownership.ServiceProject == serviceProject && ownership.Application == application
+	}
+	owner, ok := ruleOwner(gRule)
+	return strings.TrimPrefix(gRule.Name, rulePrefix(serviceProject, application)), ok && owner.ServiceProject == serviceProject && owner.Application == application
+}
+
+// ruleOwner returns the application owning a rule, from the ownership stored in the rule description or,
+// for rules without, from its name when Naming tells it. Ok is false when the owner is unknown
+func ruleOwner(gRule *compute.Firewall) (models.Ownership, bool) {
+	if ownership, ok := models.RuleOwnership(gRule); ok {
+		return ownership, true
+	}
+	serviceProject, application, ok := Naming.Owner(gRule.Name)
+	return models.Ownership{ServiceProject: serviceProject, Application: application}, ok
+}
+
+// otherLegacyOwner returns an application other than the given one whose legacy prefix could start name,
+// ok is false when name can't be the legacy name of a rule of another application
+func otherLegacyOwner(name, serviceProject, application string) (string, string, bool) {
+	parts := strings.Split(name, "-")
+	for i := 1; i < len(parts); i++ {
+		for j := i + 1; j < len(parts); j++ {
+			otherServiceProject, otherApplication := strings.Join(parts[:i], "-"), strings.Join(parts[i:j], "-")
+			if otherServiceProject != serviceProject || otherApplication != application {
+				return otherServiceProject, otherApplication, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// nameFirewallRule sets the name and the ownership of a rule of an application
+func nameFirewallRule(serviceProject, application, customName string, rule *compute.Firewall) {
+	rule.Name = firewallRuleName(serviceProject, application, customName)
+	models.SetOwnership(rule, models.Ownership{ServiceProject: serviceProject, Application: application, CustomName: customName})
+}
+
+// maxPrefixLength is the maximum length of the prefix of rule names, leaving room for custom names
+const maxPrefixLength = helpers.MaxNameLength - 10
+
+// rulePrefix returns the prefix of the name of every rule of an application,
+// shortened with a hash when it would not leave room for custom names
+func rulePrefix(serviceProject, application string) string {
+	return shortenPrefix(Naming.Prefix(serviceProject, application))
+}
+
+// shortenPrefix returns prefix shortened with a hash when it would not leave room for custom names
+func shortenPrefix(prefix string) string {
+	if len(prefix) <= maxPrefixLength {
+		return prefix
+	}
+	return shorten(strings.TrimSuffix(prefix, "-"), maxPrefixLength-1) + "-"
+}
+
+// firewallRuleName returns the name of the rule of an application matching custom name,
+// custom name being shortened with a hash when the name would be too long for Google
+func firewallRuleName(serviceProject, application, customName string) string {
+	name := Naming.RuleName(serviceProject, application, customName)
+	if len(name) <= helpers.MaxNameLength && len(Naming.Prefix(serviceProject, application)) <= maxPrefixLength {
+		return name
+	}
+	prefix := rulePrefix(serviceProject, application)
+	return prefix + shorten(customName, helpers.MaxNameLength-len(prefix))
+}
+
+// shorten returns value cut to at most length characters. Cut values end with a hash of value, so that they stay distinct
+func shorten(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	hash := hex.EncodeToString(sum[:])[:8]
+	if cut := strings.TrimRight(value[:length-len(hash)-1], "-"); cut != "" {
+		return cut + "-" + hash
+	}
+	return hash
+}
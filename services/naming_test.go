@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestNamingCollision(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host"
+
+	CreateFirewallRules(ctx, manager, project, "a", "b-c", testRules("https"), false)
+	CreateFirewallRules(ctx, manager, project, "a-b", "c", testRules("ssh"), false)
+
+	// Both applications share the legacy prefix a-b-c- but only see their own rules
+	applicationRule, err := ListFirewallRule(ctx, manager, project, "a", "b-c")
+	if err != nil {
+		t.Fatalf("Unexpected error. Got %v", err)
+	}
+	assertCustomNames(t, applicationRule.Rules, "https")
+
+	if _, err := GetFirewallRule(ctx, manager, project, "a", "b-c", "ssh"); !isNotFound(err) {
+		t.Errorf("Got error %v expected rule of another application not to be found", err)
+	}
+	if err := DeleteFirewallRule(ctx, manager, project, "a", "b-c", "ssh"); !isNotFound(err) {
+		t.Errorf("Got error %v expected rule of another application not to be found", err)
+	}
+	if _, err := UpdateFirewallRule(ctx, manager, project, "a", "b-c", "ssh", compute.Firewall{}); !isNotFound(err) {
+		t.Errorf("Got error %v expected rule of another application not to be found", err)
+	}
+
+	DeleteFirewallRules(ctx, manager, project, "a", "b-c")
+	applicationRule, _ = ListFirewallRule(ctx, manager, project, "a-b", "c")
+	assertCustomNames(t, applicationRule.Rules, "ssh")
+
+	// Ownership is stored in the description of rules
+	ownership, ok := models.RuleOwnership(&applicationRule.Rules[0].Rule)
+	if !ok || ownership != (models.Ownership{ServiceProject: "a-b", Application: "c", CustomName: "ssh"}) {
+		t.Errorf("Got ownership %+v expected a-b c ssh", ownership)
+	}
+}
+
+func TestLegacyRulesWithoutOwnership(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host"
+	manager.CreateFirewallRule(ctx, project, &compute.Firewall{Name: "a-b-c-web"})
+
+	// Neither application sharing the legacy prefix a-b-c- sees the rule
+	for _, application := range [][2]string{{"a", "b-c"}, {"a-b", "c"}} {
+		applicationRule, err := ListFirewallRule(ctx, manager, project, application[0], application[1])
+		if err != nil {
+			t.Fatalf("Unexpected error. Got %v", err)
+		}
+		assertCustomNames(t, applicationRule.Rules)
+	}
+	if err := DeleteFirewallRule(ctx, manager, project, "a", "b-c", "web"); !isNotFound(err) {
+		t.Errorf("Got error %v expected rule without ownership not to be found", err)
+	}
+	if _, err := manager.GetFirewallRule(ctx, project, "a-b-c-web"); err != nil {
+		t.Errorf("Expected rule to be kept. Got %v", err)
+	}
+}
+
+func TestHashedNaming(t *testing.T) {
+	defer func(naming NamingStrategy) { Naming = naming }(Naming)
+	naming, err := ParseNaming("hashed")
+	if err != nil {
+		t.Fatalf("Unexpected error. Got %v", err)
+	}
+	Naming = naming
+	if _, err := ParseNaming("random"); err == nil {
+		t.Errorf("Expected unknown naming strategy to be refused")
+	}
+
+	if Naming.Prefix("a", "b-c") == Naming.Prefix("a-b", "c") {
+		t.Errorf("Expected distinct prefixes. Got %s", Naming.Prefix("a", "b-c"))
+	}
+	if name := Naming.RuleName("a", "b-c", "https"); !strings.HasPrefix(name, "a-b-c-") || !strings.HasSuffix(name, "-https") || name != Naming.RuleName("a", "b-c", "https") {
+		t.Errorf("Got name %s expected a stable a-b-c-<hash>-https", name)
+	}
+
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	CreateFirewallRules(ctx, manager, "host", "a", "b-c", testRules("https"), false)
+	applicationRule, err := ListFirewallRule(ctx, manager, "host", "a", "b-c")
+	if err != nil {
+		t.Fatalf("Unexpected error. Got %v", err)
+	}
+	assertCustomNames(t, applicationRule.Rules, "https")
+}
+
+func TestLongNames(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	serviceProject, application := "foo-sp", "web"
+	longName := "allow-" + strings.Repeat("x", 50)
+
+	// Names too long for Google are shortened deterministically
+	name := firewallRuleName(serviceProject, application, longName)
+	if len(name) > helpers.MaxNameLength || helpers.ValidateName("name", name) != nil || !strings.HasPrefix(name, "foo-sp-web-allow-") {
+		t.Errorf("Got invalid name %s", name)
+	}
+	if name != firewallRuleName(serviceProject, application, longName) || name == firewallRuleName(serviceProject, application, longName+"y") {
+		t.Errorf("Expected shortened names to be stable and distinct")
+	}
+	if name := firewallRuleName(serviceProject, application, "https"); name != "foo-sp-web-https" {
+		t.Errorf("Got name %s expected short names to be kept", name)
+	}
+
+	// Long prefixes leave room for custom names
+	longApplication := strings.Repeat("a", helpers.MaxNameLength)
+	if prefix := rulePrefix(serviceProject, longApplication); len(prefix) > maxPrefixLength || !strings.HasSuffix(prefix, "-") {
+		t.Errorf("Got prefix %s of %d characters", prefix, len(prefix))
+	}
+
+	// Shortened rules are managed with their custom name
+	for _, application := range []string{application, longApplication} {
+		CreateFirewallRules(ctx, manager, "host", serviceProject, application, testRules(longName), false)
+		applicationRule, err := ListFirewallRule(ctx, manager, "host", serviceProject, application)
+		if err != nil {
+			t.Fatalf("Unexpected error. Got %v", err)
+		}
+		assertCustomNames(t, applicationRule.Rules, longName)
+		if _, err := GetFirewallRule(ctx, manager, "host", serviceProject, application, longName); err != nil {
+			t.Errorf("Unexpected error. Got %v", err)
+		}
+	}
+}
+
+func TestNamingOwner(t *testing.T) {
+	naming := HashedNaming{}
+	for _, application := range [][2]string{{"a", "b-c"}, {"a-b", "c"}, {"foo-sp", "web"}} {
+		serviceProject, app, ok := naming.Owner(naming.RuleName(application[0], application[1], "allow-https"))
+		if !ok || serviceProject != application[0] || app != application[1] {
+			t.Errorf("Got owner %s %s %v expected %s %s", serviceProject, app, ok, application[0], application[1])
+		}
+	}
+	for _, name := range []string{"legacy-https", "a-b-c-00000000-https"} {
+		if _, _, ok := naming.Owner(name); ok {
+			t.Errorf("Expected no owner for %s", name)
+		}
+	}
+	if _, _, ok := (LegacyNaming{}).Owner("foo-sp-web-https"); ok {
+		t.Errorf("Expected legacy names not to tell their owner")
+	}
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// Plan actions
+const (
+	PlanActionCreate = "create"
+	PlanActionUpdate = "update"
+	PlanActionPatch  = "patch"
+	PlanActionDelete = "delete"
+)
+
+// PlanManager records changes instead of applying them. Reads are delegated to the wrapped manager
+// and reflect changes already planned. Implements FirewallRuleManager
+type PlanManager struct {
+	manager models.FirewallRuleManager
+	mutex   sync.Mutex
+	// planned holds rules changed by the plan, deleted rules are nil
+	planned map[string]*compute.Firewall
+	actions []models.PlanAction
+}
+
+// NewPlanManager PlanManager constructor
+func NewPlanManager(manager models.FirewallRuleManager) *PlanManager {
+	return &PlanManager{
+		manager: manager,
+		planned: make(map[string]*compute.Firewall),
+	}
+}
+
+// Actions returns planned changes in order
+func (p *PlanManager) Actions() []models.PlanAction {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]models.PlanAction{}, p.actions...)
+}
+
+// ListFirewallRule returns given project's firewall rules selected by filter as they would be once the plan is applied
+func (p *PlanManager) ListFirewallRule(ctx context.Context, project string, filter models.ListFilter) ([]*compute.Firewall, error) {
+	rules, err := p.manager.ListFirewallRule(ctx, project, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var result []*compute.Firewall
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		seen[rule.Name] = true
+		if planned, ok := p.planned[key(project, rule.Name)]; ok {
+			if planned != nil && filter.Match(planned) {
+				result = append(result, planned)
+			}
+			continue
+		}
+		result = append(result, rule)
+	}
+	for _, action := range p.actions {
+		if planned := p.planned[key(project, action.Name)]; planned != nil && !seen[action.Name] && filter.Match(planned) {
+			seen[action.Name] = true
+			result = append(result, planned)
+		}
+	}
+	return result, nil
+}
+
+// GetFirewallRule returns firewall rule as it would be once the plan is applied
+func (p *PlanManager) GetFirewallRule(ctx context.Context, project, name string) (*compute.Firewall, error) {
+	p.mutex.Lock()
+	planned, ok := p.planned[key(project, name)]
+	p.mutex.Unlock()
+
+	if ok {
+		if planned == nil {
+			return nil, notFound(project, name)
+		}
+		return planned, nil
+	}
+	return p.manager.GetFirewallRule(ctx, project, name)
+}
+
+// CreateFirewallRule plans the creation of given rule
+func (p *PlanManager) CreateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	if _, err := p.GetFirewallRule(ctx, project, rule.Name); err == nil {
+		return nil, &googleapi.Error{Code: http.StatusConflict, Message: fmt.Sprintf("The resource 'projects/%s/global/firewalls/%s' already exists", project, rule.Name)}
+	} else if !isNotFound(err) {
+		return nil, err
+	}
+
+	p.record(project, models.PlanAction{Action: PlanActionCreate, Name: rule.Name, Rule: rule}, rule)
+	return rule, nil
+}
+
+// UpdateFirewallRule plans the replacement of given rule
+func (p *PlanManager) UpdateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	current, err := p.GetFirewallRule(ctx, project, rule.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	p.record(project, models.PlanAction{Action: PlanActionUpdate, Name: rule.Name, Rule: rule, Current: current, Changes: diffFirewallRule(rule, current)}, rule)
+	return rule, nil
+}
+
+// PatchFirewallRule plans the update of provided fields of given rule
+func (p *PlanManager) PatchFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	current, err := p.GetFirewallRule(ctx, project, rule.Name)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := models.MergeFirewallRule(current, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	p.record(project, models.PlanAction{Action: PlanActionPatch, Name: rule.Name, Rule: patched, Current: current, Changes: diffFirewallRule(patched, current)}, patched)
+	return patched, nil
+}
+
+// DeleteFirewallRule plans the deletion of given rule
+func (p *PlanManager) DeleteFirewallRule(ctx context.Context, project, name string) error {
+	current, err := p.GetFirewallRule(ctx, project, name)
+	if err != nil {
+		return err
+	}
+
+	p.record(project, models.PlanAction{Action: PlanActionDelete, Name: name, Current: current}, nil)
+	return nil
+}
+
+// record adds an action to the plan and keeps the planned state of the rule
+func (p *PlanManager) record(project string, action models.PlanAction, rule *compute.Firewall) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.actions = append(p.actions, action)
+	p.planned[key(project, action.Name)] = rule
+}
+
+func key(project, name string) string {
+	return project + "/" + name
+}
+
+// notFound returns the error returned by Google for a missing rule
+func notFound(project, name string) error {
+	return &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("The resource 'projects/%s/global/firewalls/%s' was not found", project, name)}
+}
+
+// isNotFound returns true when error reports a missing resource
+func isNotFound(err error) bool {
+	value, ok := err.(*googleapi.Error)
+	return ok && value.Code == http.StatusNotFound
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestPlanManager(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host-project"
+	serviceProject := "foo-sp"
+	application := "web"
+
+	CreateFirewallRules(context.Background(), manager, project, serviceProject, application, testRules("keep", "change", "remove"), false)
+
+	// Apply through a plan does not change anything
+	plan := NewPlanManager(manager)
+	desired := testRules("keep", "change", "add")
+	desired[1].Rule.Allowed[0].Ports = []string{"8443"}
+	result, err := ApplyFirewallRules(context.Background(), plan, project, serviceProject, application, desired)
+	if err != nil {
+		t.Fatalf("Unexpected error during apply. Got %v", err)
+	}
+	assertStatuses(t, result, models.RuleStatusUnchanged, models.RuleStatusUpdated, models.RuleStatusCreated, models.RuleStatusDeleted)
+
+	actions := plan.Actions()
+	expected := []string{PlanActionUpdate, PlanActionCreate, PlanActionDelete}
+	if len(actions) != len(expected) {
+		t.Fatalf("Bad actions count. Got %d expected %d", len(actions), len(expected))
+	}
+	for i, action := range actions {
+		if action.Action != expected[i] {
+			t.Errorf("Bad action %d. Got %s expected %s", i, action.Action, expected[i])
+		}
+	}
+	if actions[0].Current == nil || actions[0].Changes[0] != "allowed" {
+		t.Errorf("Update should report current rule and changes. Got %v", actions[0])
+	}
+	if actions[1].Rule.Name != "foo-sp-web-add" {
+		t.Errorf("Create should report computed rule. Got %s", actions[1].Rule.Name)
+	}
+
+	current, _ := ListFirewallRule(context.Background(), manager, project, serviceProject, application)
+	if len(current.Rules) != 3 || current.Rules[2].CustomName != "remove" {
+		t.Errorf("Dry run should not change rules. Got %v", current.Rules)
+	}
+	if port := current.Rules[1].Rule.Allowed[0].Ports[0]; port != "443" {
+		t.Errorf("Dry run should not update rules. Got port %s", port)
+	}
+
+	// Planned state is visible to following calls
+	planned, _ := ListFirewallRule(context.Background(), plan, project, serviceProject, application)
+	if len(planned.Rules) != 3 || planned.Rules[2].CustomName != "add" {
+		t.Errorf("Bad planned rules. Got %v", planned.Rules)
+	}
+
+	// Errors are reported as Google would
+	if _, err := CreateFirewallRule(context.Background(), plan, project, serviceProject, application, "keep", compute.Firewall{}); !isConflict(err) {
+		t.Errorf("Expected conflict error. Got %v", err)
+	}
+	if err := DeleteFirewallRule(context.Background(), plan, project, serviceProject, application, "remove"); !isNotFound(err) {
+		t.Errorf("Expected not found error on already planned deletion. Got %v", err)
+	}
+}
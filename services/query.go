@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+)
+
+// sortKeys returns for each sortable field the key rules are sorted by
+var sortKeys = map[string]func(rule *models.FirewallRule) string{
+	"custom_name": func(rule *models.FirewallRule) string { return rule.CustomName },
+	"priority":    func(rule *models.FirewallRule) string { return fmt.Sprintf("%010d", rule.Rule.Priority) },
+	"direction": func(rule *models.FirewallRule) string {
+		if rule.Rule.Direction == "" {
+			return "INGRESS"
+		}
+		return rule.Rule.Direction
+	},
+	"creation_timestamp": func(rule *models.FirewallRule) string { return rule.Rule.CreationTimestamp },
+}
+
+// pageCursor locates the last rule of a page
+type pageCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	Name string `json:"n"`
+}
+
+// QueryFirewallRules returns a page of the firewall rules of an application selected, sorted and paged by query.
+// Query filter is applied by the manager, other criteria are applied on rules of the application.
+func QueryFirewallRules(ctx context.Context, manager models.FirewallRuleManager, project, serviceProject, application string, query models.RuleQuery) (*models.ApplicationRule, error) {
+	ctx, span := startSpan(ctx, "QueryFirewallRules", project, serviceProject, application)
+	defer span.End()
+
+	if query.Sort == "" {
+		query.Sort = "custom_name"
+	}
+	field := strings.TrimPrefix(query.Sort, "-")
+	sortKey, ok := sortKeys[field]
+	if !ok {
+		return nil, invalidQuery("sort", fmt.Sprintf("Unknown sort field '%s'", field))
+	}
+	if _, err := path.Match(query.CustomName, ""); err != nil {
+		return nil, invalidQuery("custom_name", fmt.Sprintf("Invalid custom name pattern '%s'", query.CustomName))
+	}
+	var cursor *pageCursor
+	if query.PageToken != "" {
+		cursor = &pageCursor{}
+		data, err := base64.RawURLEncoding.DecodeString(query.PageToken)
+		if err != nil || json.Unmarshal(data, cursor) != nil || cursor.Sort != query.Sort {
+			return nil, invalidQuery("page_token", "Invalid page token")
+		}
+	}
+
+	applicationRule, err := listFirewallRule(ctx, manager, project, serviceProject, application, query.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := models.FirewallRules{}
+	for _, rule := range applicationRule.Rules {
+		if matchQuery(&query, &rule) {
+			rules = append(rules, rule)
+		}
+	}
+
+	// Sort by key then custom name, which is unique within an application
+	descending := strings.HasPrefix(query.Sort, "-")
+	less := func(key, name, otherKey, otherName string) bool {
+		if key == otherKey {
+			return name != otherName && name < otherName != descending
+		}
+		return key < otherKey != descending
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return less(sortKey(&rules[i]), rules[i].CustomName, sortKey(&rules[j]), rules[j].CustomName)
+	})
+
+	// Skip rules up to the last rule of the previous page
+	if cursor != nil {
+		start := sort.Search(len(rules), func(i int) bool {
+			return less(cursor.Key, cursor.Name, sortKey(&rules[i]), rules[i].CustomName)
+		})
+		rules = rules[start:]
+	}
+
+	if query.PageSize > 0 && len(rules) > query.PageSize {
+		rules = rules[:query.PageSize]
+		last := &rules[len(rules)-1]
+		data, _ := json.Marshal(pageCursor{Sort: query.Sort, Key: sortKey(last), Name: last.CustomName})
+		applicationRule.NextPageToken = base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	applicationRule.Rules = rules
+	return applicationRule, nil
+}
+
+// matchQuery returns true when rule matches criteria of query which are not applied by the manager
+func matchQuery(query *models.RuleQuery, rule *models.FirewallRule) bool {
+	if query.CustomName != "" {
+		if ok, _ := path.Match(query.CustomName, rule.CustomName); !ok {
+			return false
+		}
+	}
+	if query.SourceRange != "" && !contains(rule.Rule.SourceRanges, query.SourceRange) {
+		return false
+	}
+	if query.TargetTag != "" && !contains(rule.TargetTags, query.TargetTag) && !contains(rule.Rule.TargetTags, query.TargetTag) {
+		return false
+	}
+	if query.Protocol == "" && query.Port == 0 {
+		return true
+	}
+
+	for _, allowed := range rule.Rule.Allowed {
+		if matchTraffic(query, allowed.IPProtocol, allowed.Ports) {
+			return true
+		}
+	}
+	for _, denied := range rule.Rule.Denied {
+		if matchTraffic(query, denied.IPProtocol, denied.Ports) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTraffic returns true when traffic of query protocol on query port matches protocol and ports of a rule
+func matchTraffic(query *models.RuleQuery, protocol string, ports []string) bool {
+	if query.Protocol != "" && !strings.EqualFold(protocol, "all") && !strings.EqualFold(protocol, query.Protocol) {
+		return false
+	}
+	if query.Port == 0 || len(ports) == 0 {
+		return true
+	}
+
+	for _, port := range ports {
+		bounds := strings.SplitN(port, "-", 2)
+		low, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		high := low
+		if len(bounds) == 2 {
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				continue
+			}
+		}
+		if low <= query.Port && query.Port <= high {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns true when value is one of values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidQuery returns the error reporting an invalid query parameter
+func invalidQuery(field, message string) error {
+	apiError := models.NewAPIError(http.StatusBadRequest, models.ReasonInvalidArgument, message)
+	apiError.Field = field
+	return apiError
+}
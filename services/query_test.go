@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestQueryFirewallRules(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project, serviceProject, application := "host", "foo-sp", "web"
+
+	rules := testRules("https", "ssh", "dns", "egress", "all")
+	rules[0].Rule.Priority = 100
+	rules[1].Rule.Allowed[0].Ports = []string{"22"}
+	rules[1].Rule.SourceRanges = []string{"10.0.0.0/8"}
+	rules[1].Rule.TargetTags = []string{"bastion"}
+	rules[2].Rule.Allowed = []*compute.FirewallAllowed{{IPProtocol: "udp", Ports: []string{"50-60"}}}
+	rules[3].Rule.Direction = "EGRESS"
+	rules[4].Rule.Allowed = []*compute.FirewallAllowed{{IPProtocol: "all"}}
+	rules[4].Rule.Disabled = true
+	CreateFirewallRules(ctx, manager, project, serviceProject, application, rules, false)
+	CreateFirewallRules(ctx, manager, project, serviceProject, "api", testRules("https"), false)
+
+	enabled := false
+	suite := []struct {
+		Title    string
+		Query    models.RuleQuery
+		Expected []string
+	}{
+		{"every rule by custom name", models.RuleQuery{}, []string{"all", "dns", "egress", "https", "ssh"}},
+		{"descending", models.RuleQuery{Sort: "-custom_name"}, []string{"ssh", "https", "egress", "dns", "all"}},
+		{"by priority", models.RuleQuery{Sort: "priority"}, []string{"all", "dns", "egress", "ssh", "https"}},
+		{"direction", models.RuleQuery{Filter: models.ListFilter{Direction: "EGRESS"}}, []string{"egress"}},
+		{"enabled", models.RuleQuery{Filter: models.ListFilter{Disabled: &enabled}}, []string{"dns", "egress", "https", "ssh"}},
+		{"protocol", models.RuleQuery{Protocol: "udp"}, []string{"all", "dns"}},
+		{"port", models.RuleQuery{Port: 22}, []string{"all", "ssh"}},
+		{"port range", models.RuleQuery{Protocol: "udp", Port: 53}, []string{"all", "dns"}},
+		{"source range", models.RuleQuery{SourceRange: "10.0.0.0/8"}, []string{"ssh"}},
+		{"target tag", models.RuleQuery{TargetTag: "bastion"}, []string{"ssh"}},
+		{"custom name", models.RuleQuery{CustomName: "*s"}, []string{"dns", "egress", "https"}},
+	}
+
+	for _, test := range suite {
+		t.Run(test.Title, func(t *testing.T) {
+			applicationRule, err := QueryFirewallRules(ctx, manager, project, serviceProject, application, test.Query)
+			if err != nil {
+				t.Fatalf("Unexpected error. Got %v", err)
+			}
+			assertCustomNames(t, applicationRule.Rules, test.Expected...)
+		})
+	}
+
+	// Pages are chained by token
+	var names []string
+	query := models.RuleQuery{Sort: "-priority", PageSize: 2}
+	for page := 0; page < 5; page++ {
+		applicationRule, err := QueryFirewallRules(ctx, manager, project, serviceProject, application, query)
+		if err != nil {
+			t.Fatalf("Unexpected error. Got %v", err)
+		}
+		for _, rule := range applicationRule.Rules {
+			names = append(names, rule.CustomName)
+		}
+		if applicationRule.NextPageToken == "" {
+			break
+		}
+		query.PageToken = applicationRule.NextPageToken
+	}
+	expected := []string{"https", "ssh", "egress", "dns", "all"}
+	if len(names) != len(expected) {
+		t.Fatalf("Got pages %v expected %v", names, expected)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Got pages %v expected %v", names, expected)
+			break
+		}
+	}
+
+	// Invalid parameters are refused
+	for _, query := range []models.RuleQuery{{Sort: "name"}, {CustomName: "["}, {PageToken: "invalid"}, {Sort: "priority", PageToken: query.PageToken}} {
+		_, err := QueryFirewallRules(ctx, manager, project, serviceProject, application, query)
+		if apiError, ok := err.(*models.APIError); !ok || apiError.Code != http.StatusBadRequest {
+			t.Errorf("Got error %v expected a bad request for %+v", err, query)
+		}
+	}
+}
+
+func assertCustomNames(t *testing.T, rules models.FirewallRules, expected ...string) {
+	if len(rules) != len(expected) {
+		t.Fatalf("Bad rules count. Got %d expected %v", len(rules), expected)
+	}
+	for i := range expected {
+		if rules[i].CustomName != expected[i] {
+			t.Errorf("Bad rule %d. Got %s expected %v", i, rules[i].CustomName, expected)
+		}
+	}
+}
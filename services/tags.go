@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	"google.golang.org/api/compute/v1"
+)
+
+// TagMode describe how tags without the application prefix are handled
+type TagMode string
+
+// Supported tag modes
+const (
+	// TagModeRewrite prefixes tags with service project and application
+	TagModeRewrite TagMode = "rewrite"
+	// TagModeReject refuses rules with tags not prefixed by service project and application
+	TagModeReject TagMode = "reject"
+)
+
+// ParseTagMode returns the TagMode matching given name
+func ParseTagMode(name string) (TagMode, error) {
+	switch mode := TagMode(strings.ToLower(name)); mode {
+	case TagModeRewrite, TagModeReject:
+		return mode, nil
+	}
+	return "", fmt.Errorf("Unknown tag mode '%s', expected '%s' or '%s'", name, TagModeRewrite, TagModeReject)
+}
+
+// TagPolicy controls target and source tags of created and updated rules
+type TagPolicy struct {
+	Mode TagMode
+	// Exceptions are tags shared between applications and accepted without prefix
+	Exceptions []string
+}
+
+// Tags is the policy applied on rules tags
+var Tags = TagPolicy{Mode: TagModeRewrite}
+
+// isException returns true when tag is allowed without prefix
+func (t *TagPolicy) isException(tag string) bool {
+	for _, exception := range t.Exceptions {
+		if exception == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// apply forces tags of given rule to belong to the application according to policy mode
+func (t *TagPolicy) apply(serviceProject, application string, rule *compute.Firewall) error {
+	prefix := tagPrefix(serviceProject, application)
+	var violations []policy.Violation
+
+	namespace := func(field string, tags []string) []string {
+		var result []string
+		for i, tag := range tags {
+			switch {
+			case strings.HasPrefix(tag, prefix) || t.isException(tag):
+			case t.Mode == TagModeReject:
+				violations = append(violations, policy.Violation{
+					Check:   "tag_namespace",
+					Field:   fmt.Sprintf("%s[%d]", field, i),
+					Message: fmt.Sprintf("Tag '%s' must start with '%s'", tag, prefix),
+				})
+				continue
+			default:
+				tag = prefix + tag
+			}
+
+			// Google refuses tags which are not valid names, prefix included
+			if err := helpers.ValidateName("tag", tag); err != nil {
+				violations = append(violations, policy.Violation{
+					Check:   "tag_name",
+					Field:   fmt.Sprintf("%s[%d]", field, i),
+					Message: err.Error(),
+				})
+			}
+			result = append(result, tag)
+		}
+		return result
+	}
+
+	rule.TargetTags = namespace("targetTags", rule.TargetTags)
+	rule.SourceTags = namespace("sourceTags", rule.SourceTags)
+
+	if len(violations) > 0 {
+		return &policy.ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// logicalTags returns tags as given by the user, without the application prefix
+func logicalTags(serviceProject, application string, tags []string) []string {
+	prefix := tagPrefix(serviceProject, application)
+	var result []string
+	for _, tag := range tags {
+		result = append(result, strings.TrimPrefix(tag, prefix))
+	}
+	return result
+}
+
+// tagPrefix returns the prefix of every tag owned by an application. It is hashed whatever the naming strategy,
+// so that tags of distinct applications never collide
+func tagPrefix(serviceProject, application string) string {
+	return shortenPrefix(HashedNaming{}.Prefix(serviceProject, application))
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adeo/iwc-gcp-firewall-api/managertest"
+	"github.com/adeo/iwc-gcp-firewall-api/policy"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestTagPolicy(t *testing.T) {
+	serviceProject := "foo-sp"
+	application := "web"
+	prefix := tagPrefix(serviceProject, application)
+	if !strings.HasPrefix(prefix, "foo-sp-web-") || len(prefix) != len("foo-sp-web-")+9 {
+		t.Errorf("Got prefix %s expected foo-sp-web-<hash>-", prefix)
+	}
+
+	// Rewrite mode prefixes tags except exceptions and already prefixed tags
+	tags := TagPolicy{Mode: TagModeRewrite, Exceptions: []string{"shared-lb"}}
+	rule := compute.Firewall{TargetTags: []string{"front", prefix + "back", "shared-lb"}, SourceTags: []string{"bastion"}}
+	if err := tags.apply(serviceProject, application, &rule); err != nil {
+		t.Fatalf("Unexpected error during rewrite. Got %v", err)
+	}
+	expected := []string{prefix + "front", prefix + "back", "shared-lb"}
+	if !reflect.DeepEqual(rule.TargetTags, expected) {
+		t.Errorf("Bad target tags. Got %v expected %v", rule.TargetTags, expected)
+	}
+	expected = []string{prefix + "bastion"}
+	if !reflect.DeepEqual(rule.SourceTags, expected) {
+		t.Errorf("Bad source tags. Got %v expected %v", rule.SourceTags, expected)
+	}
+
+	// Reject mode reports every tag out of the application
+	tags = TagPolicy{Mode: TagModeReject, Exceptions: []string{"shared-lb"}}
+	rule = compute.Firewall{TargetTags: []string{"front", prefix + "back", "shared-lb"}, SourceTags: []string{"another-sp-app-db"}}
+	err := tags.apply(serviceProject, application, &rule)
+	violationError, ok := err.(*policy.ViolationError)
+	if !ok {
+		t.Fatalf("Expected ViolationError. Got %v", err)
+	}
+	if len(violationError.Violations) != 2 {
+		t.Errorf("Bad violations count. Got %d expected %d", len(violationError.Violations), 2)
+	}
+
+	// Tags must be valid Google names once prefixed
+	rewrite := TagPolicy{Mode: TagModeRewrite}
+	rule = compute.Firewall{TargetTags: []string{strings.Repeat("a", 60), "Front"}, SourceTags: []string{"bastion"}}
+	err = rewrite.apply(serviceProject, application, &rule)
+	if violationError, ok := err.(*policy.ViolationError); !ok || len(violationError.Violations) != 2 || violationError.Violations[0].Check != "tag_name" {
+		t.Errorf("Got error %v expected too long and uppercase tags to be refused", err)
+	}
+
+	// Tags of applications sharing a legacy prefix never collide, whatever the naming strategy
+	rule = compute.Firewall{TargetTags: []string{"web"}}
+	rewrite.apply("a", "b-c", &rule)
+	other := compute.Firewall{TargetTags: []string{"c-web"}}
+	rewrite.apply("a", "b", &other)
+	if rule.TargetTags[0] == other.TargetTags[0] {
+		t.Errorf("Got tag %s for both a/b-c and a/b expected distinct tags", rule.TargetTags[0])
+	}
+	rule = compute.Firewall{TargetTags: []string{"a-b-c-web", tagPrefix("a", "b-c") + "web"}}
+	err = tags.apply("a", "b", &rule)
+	if violationError, ok := err.(*policy.ViolationError); !ok || len(violationError.Violations) != 2 {
+		t.Errorf("Got error %v expected tags of application a/b-c to be refused", err)
+	}
+
+	// Unknown mode is refused
+	if _, err := ParseTagMode("ignore"); err == nil {
+		t.Errorf("Expected error with unknown tag mode")
+	}
+}
+
+func TestLogicalTags(t *testing.T) {
+	manager, _ := managertest.NewFirewallRuleDummyClient()
+	project := "host-project"
+
+	_, err := CreateFirewallRule(context.Background(), manager, project, "foo-sp", "web", "allow-https", compute.Firewall{TargetTags: []string{"front"}})
+	if err != nil {
+		t.Fatalf("Unexpected error during rule creation. Got %v", err)
+	}
+
+	applicationRule, err := ListFirewallRule(context.Background(), manager, project, "foo-sp", "web")
+	if err != nil {
+		t.Fatalf("Unexpected error during list. Got %v", err)
+	}
+
+	rule := applicationRule.Rules[0]
+	if !reflect.DeepEqual(rule.Rule.TargetTags, []string{tagPrefix("foo-sp", "web") + "front"}) {
+		t.Errorf("Bad raw tags. Got %v", rule.Rule.TargetTags)
+	}
+	if !reflect.DeepEqual(rule.TargetTags, []string{"front"}) {
+		t.Errorf("Bad logical tags. Got %v", rule.TargetTags)
+	}
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/adeo/iwc-gcp-firewall-api/services")
+
+// startSpan starts the span of a service call on the rules of an application
+func startSpan(ctx context.Context, name, project, serviceProject, application string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	attributes = append(attributes,
+		attribute.String("gcp.project", project),
+		attribute.String("service_project", serviceProject),
+		attribute.String("application", application),
+	)
+	return tracer.Start(ctx, "services."+name, trace.WithAttributes(attributes...))
+}
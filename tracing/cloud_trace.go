@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CloudTraceHeader is the trace context header set by Google front ends, Cloud Run included
+const CloudTraceHeader = "X-Cloud-Trace-Context"
+
+// cloudTraceValue matches TRACE_ID/SPAN_ID;o=OPTIONS where trace ID is hexadecimal and span ID decimal
+var cloudTraceValue = regexp.MustCompile(`^([0-9a-fA-F]{32})/([0-9]{1,20})(?:;o=([0-9]+))?$`)
+
+// CloudTraceContext propagates trace context with the X-Cloud-Trace-Context header. Implements TextMapPropagator
+type CloudTraceContext struct{}
+
+// Inject sets the header of the span carried by ctx into carrier
+func (CloudTraceContext) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	spanID := sc.SpanID()
+	options := 0
+	if sc.IsSampled() {
+		options = 1
+	}
+	carrier.Set(CloudTraceHeader, fmt.Sprintf("%s/%d;o=%d", sc.TraceID(), binary.BigEndian.Uint64(spanID[:]), options))
+}
+
+// Extract returns a copy of ctx carrying the remote span given by carrier header, ctx when header is missing or invalid
+func (CloudTraceContext) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	matches := cloudTraceValue.FindStringSubmatch(carrier.Get(CloudTraceHeader))
+	if matches == nil {
+		return ctx
+	}
+
+	traceID, err := trace.TraceIDFromHex(matches[1])
+	if err != nil {
+		return ctx
+	}
+	id, err := strconv.ParseUint(matches[2], 10, 64)
+	if err != nil {
+		return ctx
+	}
+	var spanID trace.SpanID
+	binary.BigEndian.PutUint64(spanID[:], id)
+
+	var flags trace.TraceFlags
+	if options, err := strconv.Atoi(matches[3]); err == nil && options&1 == 1 {
+		flags = trace.FlagsSampled
+	}
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		Remote:     true,
+	})
+	if !sc.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields returns the header set by Inject
+func (CloudTraceContext) Fields() []string {
+	return []string{CloudTraceHeader}
+}
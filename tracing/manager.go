@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/compute/v1"
+)
+
+// Manager starts a span per call to a FirewallRuleManager. Implements FirewallRuleManager
+type Manager struct {
+	manager models.FirewallRuleManager
+}
+
+// NewManager Manager constructor
+func NewManager(manager models.FirewallRuleManager) *Manager {
+	return &Manager{manager: manager}
+}
+
+// start starts the span of a call to method on project
+func start(ctx context.Context, method, project string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	attributes = append(attributes, attribute.String("gcp.project", project))
+	return tracer.Start(ctx, "FirewallRuleManager."+method, trace.WithAttributes(attributes...))
+}
+
+// ListFirewallRule lists rules through the wrapped manager
+func (m *Manager) ListFirewallRule(ctx context.Context, project string, filter models.ListFilter) ([]*compute.Firewall, error) {
+	ctx, span := start(ctx, "ListFirewallRule", project, attribute.String("filter", filter.Expression()))
+	rules, err := m.manager.ListFirewallRule(ctx, project, filter)
+	span.SetAttributes(attribute.Int("rules", len(rules)))
+	End(span, err)
+	return rules, err
+}
+
+// GetFirewallRule gets a rule through the wrapped manager
+func (m *Manager) GetFirewallRule(ctx context.Context, project, name string) (*compute.Firewall, error) {
+	ctx, span := start(ctx, "GetFirewallRule", project, attribute.String("rule", name))
+	rule, err := m.manager.GetFirewallRule(ctx, project, name)
+	End(span, err)
+	return rule, err
+}
+
+// CreateFirewallRule creates a rule through the wrapped manager
+func (m *Manager) CreateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	ctx, span := start(ctx, "CreateFirewallRule", project, attribute.String("rule", rule.Name))
+	rule, err := m.manager.CreateFirewallRule(ctx, project, rule)
+	End(span, err)
+	return rule, err
+}
+
+// UpdateFirewallRule updates a rule through the wrapped manager
+func (m *Manager) UpdateFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	ctx, span := start(ctx, "UpdateFirewallRule", project, attribute.String("rule", rule.Name))
+	rule, err := m.manager.UpdateFirewallRule(ctx, project, rule)
+	End(span, err)
+	return rule, err
+}
+
+// PatchFirewallRule patches a rule through the wrapped manager
+func (m *Manager) PatchFirewallRule(ctx context.Context, project string, rule *compute.Firewall) (*compute.Firewall, error) {
+	ctx, span := start(ctx, "PatchFirewallRule", project, attribute.String("rule", rule.Name))
+	rule, err := m.manager.PatchFirewallRule(ctx, project, rule)
+	End(span, err)
+	return rule, err
+}
+
+// DeleteFirewallRule deletes a rule through the wrapped manager
+func (m *Manager) DeleteFirewallRule(ctx context.Context, project, name string) error {
+	ctx, span := start(ctx, "DeleteFirewallRule", project, attribute.String("rule", name))
+	err := m.manager.DeleteFirewallRule(ctx, project, name)
+	End(span, err)
+	return err
+}
@@ -0,0 +1,156 @@
+// Package tracing traces requests, services and calls to Google with OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/adeo/iwc-gcp-firewall-api/helpers"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterOTLP exports spans to an OTLP HTTP endpoint configured by OTEL_EXPORTER_OTLP_* variables
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON on standard output
+	ExporterStdout = "stdout"
+)
+
+// ServiceName is the service name of exported spans, unless OTEL_SERVICE_NAME is set
+const ServiceName = "gcp-firewall-api"
+
+// TraceField, SpanIDField and SampledField are the log fields Cloud Logging uses to link an entry to a trace
+const (
+	TraceField   = "logging.googleapis.com/trace"
+	SpanIDField  = "logging.googleapis.com/spanId"
+	SampledField = "logging.googleapis.com/trace_sampled"
+)
+
+// Project is the Google project traces belong to, used to link logs to traces. Logs are not linked when empty
+var Project string
+
+var tracer = otel.Tracer("github.com/adeo/iwc-gcp-firewall-api/tracing")
+
+// Setup installs the propagators of incoming trace context and, unless exporter is empty, a tracer provider
+// exporting spans with given exporter. Returned function flushes pending spans and should be called on shutdown
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	// Honor W3C trace context and the header set by Google front ends, which wins when both are given
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, CloudTraceContext{}))
+
+	Project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if Project == "" && metadata.OnGCE() {
+		if project, err := metadata.ProjectID(); err == nil {
+			Project = project
+		} else {
+			logrus.Warnf("Unable to get project from metadata server: %v", err)
+		}
+	}
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New()
+	default:
+		return nil, fmt.Errorf("unknown exporter '%s', should be one of %s, %s", exporter, ExporterOTLP, ExporterStdout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// LogFields returns the fields linking a log entry to the span carried by ctx, none when there is no span
+func LogFields(ctx context.Context) logrus.Fields {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || Project == "" {
+		return logrus.Fields{}
+	}
+	return logrus.Fields{
+		TraceField:   fmt.Sprintf("projects/%s/traces/%s", Project, sc.TraceID()),
+		SpanIDField:  sc.SpanID().String(),
+		SampledField: sc.IsSampled(),
+	}
+}
+
+// End records err on span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statusRecorder keeps the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Middleware starts a server span per request, continuing the trace given by the caller if any
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, fmt.Sprintf("%s %s", r.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("user_agent.original", r.UserAgent()),
+			),
+		)
+		defer span.End()
+		helpers.AddLogFields(ctx, LogFields(ctx))
+
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.code))
+		if recorder.code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.code))
+		}
+	})
+}
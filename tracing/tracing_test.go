@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adeo/iwc-gcp-firewall-api/computetest"
+	"github.com/adeo/iwc-gcp-firewall-api/models"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// recorder records spans ended by tests. Tracers delegate to the first provider installed, so it is installed once
+var recorder = tracetest.NewSpanRecorder()
+
+func init() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, CloudTraceContext{}))
+}
+
+// findSpan returns the ended span named name, nil when none
+func findSpan(name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestCloudTraceContext(t *testing.T) {
+	propagator := CloudTraceContext{}
+	suite := []struct {
+		Title   string
+		Header  string
+		Valid   bool
+		Sampled bool
+	}{
+		{"sampled", "105445aa7843bc8bf206b12000100000/1;o=1", true, true},
+		{"not sampled", "105445aa7843bc8bf206b12000100000/18446744073709551615;o=0", true, false},
+		{"no options", "105445aa7843bc8bf206b12000100000/42", true, false},
+		{"missing span", "105445aa7843bc8bf206b12000100000", false, false},
+		{"zero span", "105445aa7843bc8bf206b12000100000/0;o=1", false, false},
+		{"invalid trace", "105445aa7843bc8b/1;o=1", false, false},
+		{"span overflow", "105445aa7843bc8bf206b12000100000/18446744073709551616;o=1", false, false},
+	}
+
+	for _, test := range suite {
+		t.Run(test.Title, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(CloudTraceHeader, test.Header)
+			sc := trace.SpanContextFromContext(propagator.Extract(context.Background(), propagation.HeaderCarrier(header)))
+			if sc.IsValid() != test.Valid || sc.IsSampled() != test.Sampled {
+				t.Fatalf("Got span context %+v expected valid %v and sampled %v", sc, test.Valid, test.Sampled)
+			}
+			if !test.Valid {
+				return
+			}
+
+			// Injected header is the extracted one
+			injected := http.Header{}
+			propagator.Inject(trace.ContextWithSpanContext(context.Background(), sc), propagation.HeaderCarrier(injected))
+			if got := trace.SpanContextFromContext(propagator.Extract(context.Background(), propagation.HeaderCarrier(injected))); !got.Equal(sc) {
+				t.Errorf("Got span context %+v from %s expected %+v", got, injected.Get(CloudTraceHeader), sc)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.Path("/project/{project}").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	req := httptest.NewRequest("GET", "/project/host", nil)
+	req.Header.Set(CloudTraceHeader, "105445aa7843bc8bf206b12000100000/1;o=1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	span := findSpan("GET /project/{project}")
+	if span == nil {
+		t.Fatalf("Expected a span named by route template")
+	}
+	if span.SpanKind() != trace.SpanKindServer || span.Status().Code != codes.Error {
+		t.Errorf("Got span kind %v and status %v expected an errored server span", span.SpanKind(), span.Status())
+	}
+	if span.SpanContext().TraceID().String() != "105445aa7843bc8bf206b12000100000" || !span.Parent().IsRemote() {
+		t.Errorf("Got trace %s expected the trace of the caller", span.SpanContext().TraceID())
+	}
+}
+
+func TestManager(t *testing.T) {
+	server := computetest.NewServer()
+	defer server.Close()
+	server.PendingPolls = 1
+	defer func(interval time.Duration) { models.OperationPollInterval = interval }(models.OperationPollInterval)
+	models.OperationPollInterval = time.Millisecond
+	client, err := models.NewFirewallRuleClient(server.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("Unexpected error creating client. Got %v", err)
+	}
+	manager := NewManager(client)
+
+	manager.CreateFirewallRule(context.Background(), "host", &compute.Firewall{Name: "foo-sp-web-https"})
+	if _, err := manager.GetFirewallRule(context.Background(), "host", "unknown"); err == nil {
+		t.Fatalf("Expected error getting unknown rule")
+	}
+
+	// Each HTTP call to Google of a creation is a child span of the call to the manager
+	create := findSpan("FirewallRuleManager.CreateFirewallRule")
+	if create == nil {
+		t.Fatalf("Expected a span of the call to the manager")
+	}
+	calls := map[string]int{}
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == create.SpanContext().SpanID() {
+			if span.SpanKind() != trace.SpanKindClient {
+				t.Errorf("Got span %s of kind %v expected only HTTP client spans", span.Name(), span.SpanKind())
+			}
+			calls[span.Name()]++
+		}
+	}
+	// Insertion, then two polls of the operation and reading of the created rule
+	if calls["HTTP POST"] != 1 || calls["HTTP GET"] != 3 {
+		t.Errorf("Got HTTP spans %v expected 1 POST and 3 GET", calls)
+	}
+
+	if get := findSpan("FirewallRuleManager.GetFirewallRule"); get == nil || get.Status().Code != codes.Error {
+		t.Errorf("Expected the failed call to be recorded as an error")
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	if fields := LogFields(context.Background()); len(fields) != 0 {
+		t.Errorf("Got fields %v expected none without span", fields)
+	}
+
+	Project = "host"
+	defer func() { Project = "" }()
+	header := http.Header{}
+	header.Set(CloudTraceHeader, "105445aa7843bc8bf206b12000100000/1;o=1")
+	ctx := CloudTraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(header))
+
+	expected := logrus.Fields{
+		TraceField:   "projects/host/traces/105445aa7843bc8bf206b12000100000",
+		SpanIDField:  "0000000000000001",
+		SampledField: true,
+	}
+	fields := LogFields(ctx)
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("Got %s %v expected %v", key, fields[key], value)
+		}
+	}
+}